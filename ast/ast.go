@@ -9,6 +9,8 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position // position of the first character of the node
+	End() token.Position // position immediately after the node
 }
 
 type Statement interface {
@@ -22,9 +24,10 @@ type Expression interface {
 }
 
 type LetStatement struct {
-	Token token.Token
-	Name  *Identifier
-	Value Expression
+	Token   token.Token
+	Name    *Identifier
+	Pattern Expression // destructuring pattern, set instead of Name
+	Value   Expression
 }
 
 func (ls *LetStatement) statementNode() {}
@@ -37,7 +40,11 @@ func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(ls.Token.Literal)
 	out.WriteString(" ")
-	out.WriteString(ls.Name.String())
+	if ls.Pattern != nil {
+		out.WriteString(ls.Pattern.String())
+	} else {
+		out.WriteString(ls.Name.String())
+	}
 	out.WriteString(" = ")
 	if ls.Value != nil {
 		out.WriteString(ls.Value.String())
@@ -46,6 +53,93 @@ func (ls *LetStatement) String() string {
 	return out.String()
 }
 
+func (ls *LetStatement) Pos() token.Position {
+	return ls.Token.Pos
+}
+
+func (ls *LetStatement) End() token.Position {
+	if ls.Value != nil {
+		return ls.Value.End()
+	}
+	if ls.Pattern != nil {
+		return ls.Pattern.End()
+	}
+	if ls.Name != nil {
+		return ls.Name.End()
+	}
+	return ls.Token.End
+}
+
+// ArrayPattern destructures an array into its elements, which are
+// identifiers or nested patterns, and an optional rest identifier.
+type ArrayPattern struct {
+	Token    token.Token
+	Elements []Expression
+	Rest     *Identifier
+	Rbracket token.Position
+}
+
+func (ap *ArrayPattern) expressionNode() {}
+
+func (ap *ArrayPattern) TokenLiteral() string {
+	return ap.Token.Literal
+}
+
+func (ap *ArrayPattern) String() string {
+	elements := []string{}
+	for _, element := range ap.Elements {
+		elements = append(elements, element.String())
+	}
+	if ap.Rest != nil {
+		elements = append(elements, "..."+ap.Rest.String())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+func (ap *ArrayPattern) Pos() token.Position {
+	return ap.Token.Pos
+}
+
+func (ap *ArrayPattern) End() token.Position {
+	if ap.Rbracket.IsValid() {
+		return after(ap.Rbracket)
+	}
+	return ap.Token.End
+}
+
+// HashPattern binds the values stored under string keys of a hash to
+// identifiers of the same name.
+type HashPattern struct {
+	Token  token.Token
+	Keys   []*Identifier
+	Rbrace token.Position
+}
+
+func (hp *HashPattern) expressionNode() {}
+
+func (hp *HashPattern) TokenLiteral() string {
+	return hp.Token.Literal
+}
+
+func (hp *HashPattern) String() string {
+	keys := []string{}
+	for _, key := range hp.Keys {
+		keys = append(keys, key.String())
+	}
+	return "{" + strings.Join(keys, ", ") + "}"
+}
+
+func (hp *HashPattern) Pos() token.Position {
+	return hp.Token.Pos
+}
+
+func (hp *HashPattern) End() token.Position {
+	if hp.Rbrace.IsValid() {
+		return after(hp.Rbrace)
+	}
+	return hp.Token.End
+}
+
 type Identifier struct {
 	Token token.Token
 	Value string
@@ -61,6 +155,14 @@ func (i *Identifier) String() string {
 	return i.Value
 }
 
+func (i *Identifier) Pos() token.Position {
+	return i.Token.Pos
+}
+
+func (i *Identifier) End() token.Position {
+	return i.Token.End
+}
+
 type ReturnStatement struct {
 	Token       token.Token
 	ReturnValue Expression
@@ -83,6 +185,129 @@ func (rs *ReturnStatement) String() string {
 	return rs.TokenLiteral() + " " + rs.ReturnValue.String() + ";"
 }
 
+func (rs *ReturnStatement) Pos() token.Position {
+	return rs.Token.Pos
+}
+
+func (rs *ReturnStatement) End() token.Position {
+	if rs.ReturnValue != nil {
+		return rs.ReturnValue.End()
+	}
+	return rs.Token.End
+}
+
+type WhileStatement struct {
+	Token     token.Token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode() {}
+
+func (ws *WhileStatement) TokenLiteral() string {
+	return ws.Token.Literal
+}
+
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("while ")
+	out.WriteString(ws.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ws.Body.String())
+	return out.String()
+}
+
+func (ws *WhileStatement) Pos() token.Position {
+	return ws.Token.Pos
+}
+
+func (ws *WhileStatement) End() token.Position {
+	if ws.Body != nil {
+		return ws.Body.End()
+	}
+	return ws.Token.End
+}
+
+// ForStatement is a `for (Variable in Iterable) { Body }` loop.
+type ForStatement struct {
+	Token    token.Token
+	Variable *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForStatement) statementNode() {}
+
+func (fs *ForStatement) TokenLiteral() string {
+	return fs.Token.Literal
+}
+
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("for ")
+	out.WriteString(fs.Variable.String())
+	out.WriteString(" in ")
+	out.WriteString(fs.Iterable.String())
+	out.WriteString(" ")
+	out.WriteString(fs.Body.String())
+	return out.String()
+}
+
+func (fs *ForStatement) Pos() token.Position {
+	return fs.Token.Pos
+}
+
+func (fs *ForStatement) End() token.Position {
+	if fs.Body != nil {
+		return fs.Body.End()
+	}
+	return fs.Token.End
+}
+
+type BreakStatement struct {
+	Token token.Token
+}
+
+func (bs *BreakStatement) statementNode() {}
+
+func (bs *BreakStatement) TokenLiteral() string {
+	return bs.Token.Literal
+}
+
+func (bs *BreakStatement) String() string {
+	return bs.Token.Literal + ";"
+}
+
+func (bs *BreakStatement) Pos() token.Position {
+	return bs.Token.Pos
+}
+
+func (bs *BreakStatement) End() token.Position {
+	return bs.Token.End
+}
+
+type ContinueStatement struct {
+	Token token.Token
+}
+
+func (cs *ContinueStatement) statementNode() {}
+
+func (cs *ContinueStatement) TokenLiteral() string {
+	return cs.Token.Literal
+}
+
+func (cs *ContinueStatement) String() string {
+	return cs.Token.Literal + ";"
+}
+
+func (cs *ContinueStatement) Pos() token.Position {
+	return cs.Token.Pos
+}
+
+func (cs *ContinueStatement) End() token.Position {
+	return cs.Token.End
+}
+
 type ExpressionStatement struct {
 	Token      token.Token
 	Expression Expression
@@ -101,8 +326,20 @@ func (es *ExpressionStatement) String() string {
 	return ""
 }
 
+func (es *ExpressionStatement) Pos() token.Position {
+	return es.Token.Pos
+}
+
+func (es *ExpressionStatement) End() token.Position {
+	if es.Expression != nil {
+		return es.Expression.End()
+	}
+	return es.Token.End
+}
+
 type Program struct {
 	Statements []Statement
+	Comments   []*Comment // set when the lexer emits comments, in source order
 }
 
 func (p *Program) TokenLiteral() string {
@@ -121,6 +358,42 @@ func (p *Program) String() string {
 	return str.String()
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
+func (p *Program) End() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[len(p.Statements)-1].End()
+	}
+	return token.Position{}
+}
+
+// Comment is a line or block comment. Comments are kept apart from the
+// statements, so the evaluator and the compiler never see them.
+type Comment struct {
+	Token token.Token
+}
+
+func (c *Comment) TokenLiteral() string {
+	return c.Token.Literal
+}
+
+func (c *Comment) String() string {
+	return c.Token.Literal
+}
+
+func (c *Comment) Pos() token.Position {
+	return c.Token.Pos
+}
+
+func (c *Comment) End() token.Position {
+	return c.Token.End
+}
+
 type IntegerLiteral struct {
 	Token token.Token
 	Value int64
@@ -136,6 +409,37 @@ func (il *IntegerLiteral) String() string {
 	return il.Token.Literal
 }
 
+func (il *IntegerLiteral) Pos() token.Position {
+	return il.Token.Pos
+}
+
+func (il *IntegerLiteral) End() token.Position {
+	return il.Token.End
+}
+
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode() {}
+
+func (fl *FloatLiteral) TokenLiteral() string {
+	return fl.Token.Literal
+}
+
+func (fl *FloatLiteral) String() string {
+	return fl.Token.Literal
+}
+
+func (fl *FloatLiteral) Pos() token.Position {
+	return fl.Token.Pos
+}
+
+func (fl *FloatLiteral) End() token.Position {
+	return fl.Token.End
+}
+
 type PrefixExpression struct {
 	Token    token.Token
 	Operator string
@@ -157,6 +461,17 @@ func (pe *PrefixExpression) String() string {
 	return out.String()
 }
 
+func (pe *PrefixExpression) Pos() token.Position {
+	return pe.Token.Pos
+}
+
+func (pe *PrefixExpression) End() token.Position {
+	if pe.Right != nil {
+		return pe.Right.End()
+	}
+	return pe.Token.End
+}
+
 type InfixExpression struct {
 	Token    token.Token
 	Left     Expression
@@ -182,6 +497,100 @@ func (ie *InfixExpression) String() string {
 	return out.String()
 }
 
+func (ie *InfixExpression) Pos() token.Position {
+	if ie.Left != nil {
+		return ie.Left.Pos()
+	}
+	return ie.Token.Pos
+}
+
+func (ie *InfixExpression) End() token.Position {
+	if ie.Right != nil {
+		return ie.Right.End()
+	}
+	return ie.Token.End
+}
+
+// LogicalExpression is a short-circuiting `&&` or `||`. It is kept apart
+// from InfixExpression because its right operand is evaluated lazily.
+type LogicalExpression struct {
+	Token    token.Token
+	Left     Expression
+	Operator string
+	Right    Expression
+}
+
+func (le *LogicalExpression) expressionNode() {}
+
+func (le *LogicalExpression) TokenLiteral() string {
+	return le.Token.Literal
+}
+
+func (le *LogicalExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(le.Left.String())
+	out.WriteString(" ")
+	out.WriteString(le.Operator)
+	out.WriteString(" ")
+	out.WriteString(le.Right.String())
+	out.WriteString(")")
+	return out.String()
+}
+
+func (le *LogicalExpression) Pos() token.Position {
+	if le.Left != nil {
+		return le.Left.Pos()
+	}
+	return le.Token.Pos
+}
+
+func (le *LogicalExpression) End() token.Position {
+	if le.Right != nil {
+		return le.Right.End()
+	}
+	return le.Token.End
+}
+
+// AssignExpression rebinds an existing variable, array element or hash
+// entry. Target is either an *Identifier or an *IndexExpression.
+type AssignExpression struct {
+	Token    token.Token
+	Target   Expression
+	Operator string // "=" or a compound operator such as "+="
+	Value    Expression
+}
+
+func (ae *AssignExpression) expressionNode() {}
+
+func (ae *AssignExpression) TokenLiteral() string {
+	return ae.Token.Literal
+}
+
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString(ae.Target.String())
+	out.WriteString(" ")
+	out.WriteString(ae.Operator)
+	out.WriteString(" ")
+	out.WriteString(ae.Value.String())
+	return out.String()
+}
+
+func (ae *AssignExpression) Pos() token.Position {
+	if ae.Target != nil {
+		return ae.Target.Pos()
+	}
+	return ae.Token.Pos
+}
+
+func (ae *AssignExpression) End() token.Position {
+	if ae.Value != nil {
+		return ae.Value.End()
+	}
+	return ae.Token.End
+}
+
 type Boolean struct {
 	Token token.Token
 	Value bool
@@ -197,6 +606,14 @@ func (b *Boolean) String() string {
 	return b.Token.Literal
 }
 
+func (b *Boolean) Pos() token.Position {
+	return b.Token.Pos
+}
+
+func (b *Boolean) End() token.Position {
+	return b.Token.End
+}
+
 type IfExpression struct {
 	Token       token.Token
 	Condition   Expression
@@ -223,9 +640,123 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+func (ie *IfExpression) Pos() token.Position {
+	return ie.Token.Pos
+}
+
+func (ie *IfExpression) End() token.Position {
+	if ie.Alternative != nil {
+		return ie.Alternative.End()
+	}
+	if ie.Consequence != nil {
+		return ie.Consequence.End()
+	}
+	return ie.Token.End
+}
+
+type MatchExpression struct {
+	Token   token.Token
+	Subject Expression
+	Arms    []*MatchArm
+	Rbrace  token.Position
+}
+
+// MatchArm is a single `patterns => body` branch of a match expression.
+// Patterns are literals, array literals of patterns or the wildcard `_`.
+type MatchArm struct {
+	Patterns []Expression
+	Body     *BlockStatement
+}
+
+func (me *MatchExpression) expressionNode() {}
+
+func (me *MatchExpression) TokenLiteral() string {
+	return me.Token.Literal
+}
+
+func (me *MatchExpression) String() string {
+	var out bytes.Buffer
+	arms := []string{}
+	for _, arm := range me.Arms {
+		patterns := []string{}
+		for _, pattern := range arm.Patterns {
+			patterns = append(patterns, pattern.String())
+		}
+		arms = append(arms, strings.Join(patterns, ", ")+" => "+arm.Body.String())
+	}
+	out.WriteString(me.TokenLiteral())
+	out.WriteString(" (")
+	out.WriteString(me.Subject.String())
+	out.WriteString(") { ")
+	out.WriteString(strings.Join(arms, ", "))
+	out.WriteString(" }")
+	return out.String()
+}
+
+func (me *MatchExpression) Pos() token.Position {
+	return me.Token.Pos
+}
+
+func (me *MatchExpression) End() token.Position {
+	if me.Rbrace.IsValid() {
+		return after(me.Rbrace)
+	}
+	return me.Token.End
+}
+
+type TryExpression struct {
+	Token     token.Token
+	Block     *BlockStatement
+	Parameter *Identifier // bound to the caught error, set with Catch
+	Catch     *BlockStatement
+	Finally   *BlockStatement
+}
+
+func (te *TryExpression) expressionNode() {}
+
+func (te *TryExpression) TokenLiteral() string {
+	return te.Token.Literal
+}
+
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString(te.TokenLiteral())
+	out.WriteString(" ")
+	out.WriteString(te.Block.String())
+	if te.Catch != nil {
+		out.WriteString(" catch (")
+		out.WriteString(te.Parameter.String())
+		out.WriteString(") ")
+		out.WriteString(te.Catch.String())
+	}
+	if te.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(te.Finally.String())
+	}
+	return out.String()
+}
+
+func (te *TryExpression) Pos() token.Position {
+	return te.Token.Pos
+}
+
+func (te *TryExpression) End() token.Position {
+	if te.Finally != nil {
+		return te.Finally.End()
+	}
+	if te.Catch != nil {
+		return te.Catch.End()
+	}
+	if te.Block != nil {
+		return te.Block.End()
+	}
+	return te.Token.End
+}
+
 type BlockStatement struct {
 	Token      token.Token
 	Statements []Statement
+	Rbrace     token.Position
 }
 
 func (bs *BlockStatement) statementNode() {}
@@ -242,10 +773,47 @@ func (bs *BlockStatement) String() string {
 	return out.String()
 }
 
+func (bs *BlockStatement) Pos() token.Position {
+	return bs.Token.Pos
+}
+
+func (bs *BlockStatement) End() token.Position {
+	if bs.Rbrace.IsValid() {
+		return after(bs.Rbrace)
+	}
+	if len(bs.Statements) > 0 {
+		return bs.Statements[len(bs.Statements)-1].End()
+	}
+	return bs.Token.End
+}
+
 type FunctionLiteral struct {
 	Token      token.Token
-	Parameters []*Identifier
+	Parameters []*Parameter
+	Rest       *Identifier // collects the remaining arguments, may be nil
 	Body       *BlockStatement
+	Name       string // set when the literal is bound with let
+}
+
+// Parameter is a single parameter of a function literal, bound either to
+// a name or to a destructuring pattern.
+type Parameter struct {
+	Name    *Identifier
+	Pattern Expression // destructuring pattern, set instead of Name
+	Default Expression // value used when the argument is missing, may be nil
+}
+
+func (p *Parameter) String() string {
+	var out string
+	if p.Pattern != nil {
+		out = p.Pattern.String()
+	} else {
+		out = p.Name.String()
+	}
+	if p.Default != nil {
+		out += " = " + p.Default.String()
+	}
+	return out
 }
 
 func (fl *FunctionLiteral) expressionNode() {}
@@ -262,6 +830,9 @@ func (fl *FunctionLiteral) String() string {
 	for i, param := range fl.Parameters {
 		params[i] = param.String()
 	}
+	if fl.Rest != nil {
+		params = append(params, "..."+fl.Rest.String())
+	}
 	out.WriteString(strings.Join(params, ", "))
 
 	out.WriteString(")")
@@ -269,10 +840,90 @@ func (fl *FunctionLiteral) String() string {
 	return out.String()
 }
 
+func (fl *FunctionLiteral) Pos() token.Position {
+	return fl.Token.Pos
+}
+
+func (fl *FunctionLiteral) End() token.Position {
+	if fl.Body != nil {
+		return fl.Body.End()
+	}
+	return fl.Token.End
+}
+
+// MacroLiteral is a `macro(parameters) { body }` literal. Macros are bound
+// with a top-level let statement and called before the program runs.
+type MacroLiteral struct {
+	Token      token.Token
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (ml *MacroLiteral) expressionNode() {}
+
+func (ml *MacroLiteral) TokenLiteral() string {
+	return ml.Token.Literal
+}
+
+func (ml *MacroLiteral) String() string {
+	var out bytes.Buffer
+	params := make([]string, len(ml.Parameters))
+	for i, param := range ml.Parameters {
+		params[i] = param.String()
+	}
+	out.WriteString(ml.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(")")
+	out.WriteString(ml.Body.String())
+	return out.String()
+}
+
+func (ml *MacroLiteral) Pos() token.Position {
+	return ml.Token.Pos
+}
+
+func (ml *MacroLiteral) End() token.Position {
+	if ml.Body != nil {
+		return ml.Body.End()
+	}
+	return ml.Token.End
+}
+
+// SpreadExpression expands an array into the surrounding argument list or
+// array literal.
+type SpreadExpression struct {
+	Token token.Token
+	Value Expression
+}
+
+func (se *SpreadExpression) expressionNode() {}
+
+func (se *SpreadExpression) TokenLiteral() string {
+	return se.Token.Literal
+}
+
+func (se *SpreadExpression) String() string {
+	return "..." + se.Value.String()
+}
+
+func (se *SpreadExpression) Pos() token.Position {
+	return se.Token.Pos
+}
+
+func (se *SpreadExpression) End() token.Position {
+	if se.Value != nil {
+		return se.Value.End()
+	}
+	return se.Token.End
+}
+
 type CallExpression struct {
 	Token     token.Token
 	Function  Expression
 	Arguments []Expression
+	Rparen    token.Position
+	Tail      bool // the call is in tail position of a function body
 }
 
 func (ce *CallExpression) expressionNode() {}
@@ -294,6 +945,20 @@ func (ce *CallExpression) String() string {
 	return out.String()
 }
 
+func (ce *CallExpression) Pos() token.Position {
+	if ce.Function != nil {
+		return ce.Function.Pos()
+	}
+	return ce.Token.Pos
+}
+
+func (ce *CallExpression) End() token.Position {
+	if ce.Rparen.IsValid() {
+		return after(ce.Rparen)
+	}
+	return ce.Token.End
+}
+
 type StringLiteral struct {
 	Token token.Token
 	Value string
@@ -309,9 +974,18 @@ func (sl *StringLiteral) String() string {
 	return sl.Token.Literal
 }
 
+func (sl *StringLiteral) Pos() token.Position {
+	return sl.Token.Pos
+}
+
+func (sl *StringLiteral) End() token.Position {
+	return sl.Token.End
+}
+
 type ArrayLiteral struct {
 	Token    token.Token
 	Elements []Expression
+	Rbracket token.Position
 }
 
 func (al *ArrayLiteral) expressionNode() {}
@@ -333,10 +1007,22 @@ func (al *ArrayLiteral) String() string {
 	return out.String()
 }
 
+func (al *ArrayLiteral) Pos() token.Position {
+	return al.Token.Pos
+}
+
+func (al *ArrayLiteral) End() token.Position {
+	if al.Rbracket.IsValid() {
+		return after(al.Rbracket)
+	}
+	return al.Token.End
+}
+
 type IndexExpression struct {
-	Token token.Token
-	Left  Expression
-	Index Expression
+	Token    token.Token
+	Left     Expression
+	Index    Expression
+	Rbracket token.Position
 }
 
 func (ie *IndexExpression) expressionNode() {}
@@ -355,3 +1041,66 @@ func (ie *IndexExpression) String() string {
 	out.WriteString("])")
 	return out.String()
 }
+
+func (ie *IndexExpression) Pos() token.Position {
+	if ie.Left != nil {
+		return ie.Left.Pos()
+	}
+	return ie.Token.Pos
+}
+
+func (ie *IndexExpression) End() token.Position {
+	if ie.Rbracket.IsValid() {
+		return after(ie.Rbracket)
+	}
+	return ie.Token.End
+}
+
+type HashLiteral struct {
+	Token  token.Token
+	Pairs  []*HashPair // in source order
+	Rbrace token.Position
+}
+
+// HashPair is a single `key: value` entry of a hash literal.
+type HashPair struct {
+	Key   Expression
+	Value Expression
+}
+
+func (hl *HashLiteral) expressionNode() {}
+
+func (hl *HashLiteral) TokenLiteral() string {
+	return hl.Token.Literal
+}
+
+func (hl *HashLiteral) String() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, pair.Key.String()+":"+pair.Value.String())
+	}
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
+func (hl *HashLiteral) Pos() token.Position {
+	return hl.Token.Pos
+}
+
+func (hl *HashLiteral) End() token.Position {
+	if hl.Rbrace.IsValid() {
+		return after(hl.Rbrace)
+	}
+	return hl.Token.End
+}
+
+// after returns the position following a single-character token at pos.
+func after(pos token.Position) token.Position {
+	pos.Offset++
+	pos.Column++
+	return pos
+}
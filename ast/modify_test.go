@@ -0,0 +1,144 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestModify(t *testing.T) {
+	one := func() Expression { return &IntegerLiteral{Value: 1} }
+	two := func() Expression { return &IntegerLiteral{Value: 2} }
+	ident := func(name string) *Identifier { return &Identifier{Value: name} }
+	block := func(e Expression) *BlockStatement {
+		return &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: e}}}
+	}
+
+	turnOneIntoTwo := func(node Node) Node {
+		integer, ok := node.(*IntegerLiteral)
+		if !ok {
+			return node
+		}
+		if integer.Value != 1 {
+			return node
+		}
+		integer.Value = 2
+		return integer
+	}
+
+	tests := []struct {
+		input    Node
+		expected Node
+	}{
+		{one(), two()},
+		{
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+		},
+		{&InfixExpression{Left: one(), Operator: "+", Right: two()}, &InfixExpression{Left: two(), Operator: "+", Right: two()}},
+		{&InfixExpression{Left: two(), Operator: "+", Right: one()}, &InfixExpression{Left: two(), Operator: "+", Right: two()}},
+		{&LogicalExpression{Left: one(), Operator: "&&", Right: one()}, &LogicalExpression{Left: two(), Operator: "&&", Right: two()}},
+		{&PrefixExpression{Operator: "-", Right: one()}, &PrefixExpression{Operator: "-", Right: two()}},
+		{&IndexExpression{Left: one(), Index: one()}, &IndexExpression{Left: two(), Index: two()}},
+		{&AssignExpression{Target: &IndexExpression{Left: ident("a"), Index: one()}, Operator: "=", Value: one()},
+			&AssignExpression{Target: &IndexExpression{Left: ident("a"), Index: two()}, Operator: "=", Value: two()}},
+		{
+			&IfExpression{Condition: one(), Consequence: block(one()), Alternative: block(one())},
+			&IfExpression{Condition: two(), Consequence: block(two()), Alternative: block(two())},
+		},
+		{&IfExpression{Condition: one(), Consequence: block(one())}, &IfExpression{Condition: two(), Consequence: block(two())}},
+		{&ReturnStatement{ReturnValue: one()}, &ReturnStatement{ReturnValue: two()}},
+		{&LetStatement{Name: ident("x"), Value: one()}, &LetStatement{Name: ident("x"), Value: two()}},
+		{&WhileStatement{Condition: one(), Body: block(one())}, &WhileStatement{Condition: two(), Body: block(two())}},
+		{
+			&ForStatement{Variable: ident("x"), Iterable: &ArrayLiteral{Elements: []Expression{one()}}, Body: block(one())},
+			&ForStatement{Variable: ident("x"), Iterable: &ArrayLiteral{Elements: []Expression{two()}}, Body: block(two())},
+		},
+		{
+			&FunctionLiteral{Parameters: []*Parameter{{Name: ident("a"), Default: one()}}, Body: block(one())},
+			&FunctionLiteral{Parameters: []*Parameter{{Name: ident("a"), Default: two()}}, Body: block(two())},
+		},
+		{
+			&MacroLiteral{Parameters: []*Identifier{ident("a")}, Body: block(one())},
+			&MacroLiteral{Parameters: []*Identifier{ident("a")}, Body: block(two())},
+		},
+		{
+			&CallExpression{Function: ident("f"), Arguments: []Expression{one(), &SpreadExpression{Value: one()}}},
+			&CallExpression{Function: ident("f"), Arguments: []Expression{two(), &SpreadExpression{Value: two()}}},
+		},
+		{&ArrayLiteral{Elements: []Expression{one(), one()}}, &ArrayLiteral{Elements: []Expression{two(), two()}}},
+		{
+			&MatchExpression{Subject: one(), Arms: []*MatchArm{{Patterns: []Expression{one()}, Body: block(one())}}},
+			&MatchExpression{Subject: two(), Arms: []*MatchArm{{Patterns: []Expression{two()}, Body: block(two())}}},
+		},
+		{
+			&TryExpression{Block: block(one()), Parameter: ident("e"), Catch: block(one()), Finally: block(one())},
+			&TryExpression{Block: block(two()), Parameter: ident("e"), Catch: block(two()), Finally: block(two())},
+		},
+	}
+
+	for _, tt := range tests {
+		modified := Modify(tt.input, turnOneIntoTwo)
+		if !reflect.DeepEqual(modified, tt.expected) {
+			t.Errorf("not equal. got=%#v, want=%#v", modified, tt.expected)
+		}
+	}
+
+	hashLiteral := &HashLiteral{Pairs: []*HashPair{{Key: one(), Value: one()}, {Key: one(), Value: one()}}}
+	Modify(hashLiteral, turnOneIntoTwo)
+	for _, pair := range hashLiteral.Pairs {
+		key, _ := pair.Key.(*IntegerLiteral)
+		if key.Value != 2 {
+			t.Errorf("value is not %d, got=%d", 2, key.Value)
+		}
+		val, _ := pair.Value.(*IntegerLiteral)
+		if val.Value != 2 {
+			t.Errorf("value is not %d, got=%d", 2, val.Value)
+		}
+	}
+}
+
+func TestModifyKeepsNodesThatDoNotFit(t *testing.T) {
+	toInteger := func(node Node) Node {
+		if identifier, ok := node.(*Identifier); ok && identifier.Value == "x" {
+			return &IntegerLiteral{Value: 1}
+		}
+		if _, ok := node.(*ExpressionStatement); ok {
+			return &IntegerLiteral{Value: 2}
+		}
+		return node
+	}
+
+	let := &LetStatement{Name: &Identifier{Value: "x"}, Value: &Identifier{Value: "x"}}
+	Modify(&Program{Statements: []Statement{let, &ExpressionStatement{}}}, toInteger)
+
+	if let.Name.Value != "x" {
+		t.Errorf("let name was replaced. got=%#v", let.Name)
+	}
+	if _, ok := let.Value.(*IntegerLiteral); !ok {
+		t.Errorf("let value was not replaced. got=%#v", let.Value)
+	}
+}
+
+func TestModifyFunctionParameters(t *testing.T) {
+	rename := func(node Node) Node {
+		if identifier, ok := node.(*Identifier); ok && identifier.Value == "a" {
+			return &Identifier{Value: "b"}
+		}
+		return node
+	}
+
+	fn := &FunctionLiteral{
+		Parameters: []*Parameter{
+			{Name: &Identifier{Value: "a"}, Default: &Identifier{Value: "a"}},
+			{Pattern: &ArrayPattern{Elements: []Expression{&Identifier{Value: "a"}}}},
+			{Pattern: &ArrayPattern{Elements: []Expression{&Identifier{Value: "a"}}}},
+		},
+		Body: &BlockStatement{},
+	}
+	Modify(fn, rename)
+
+	expected := "(b = b, [b], [b])"
+	if fn.String() != expected {
+		t.Errorf("parameters not modified. got=%q, want=%q", fn.String(), expected)
+	}
+}
@@ -0,0 +1,381 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// A Visitor's Visit method is called by Walk for each node. If the visitor
+// w it returns is not nil, Walk visits each of the children of node with w,
+// followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses an AST in depth-first order, in the order the nodes appear
+// in the source. It starts by calling v.Visit(node), which must not be nil.
+//
+// Function parameters and match arms, which are not nodes, are visited as
+// their name or pattern followed by their default value, and as their
+// patterns followed by their body.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		walkStatements(v, n.Statements)
+
+	case *LetStatement:
+		if n.Pattern != nil {
+			walk(v, n.Pattern)
+		} else {
+			walk(v, n.Name)
+		}
+		walk(v, n.Value)
+
+	case *ReturnStatement:
+		walk(v, n.ReturnValue)
+
+	case *WhileStatement:
+		walk(v, n.Condition)
+		walk(v, n.Body)
+
+	case *ForStatement:
+		walk(v, n.Variable)
+		walk(v, n.Iterable)
+		walk(v, n.Body)
+
+	case *ExpressionStatement:
+		walk(v, n.Expression)
+
+	case *BlockStatement:
+		walkStatements(v, n.Statements)
+
+	case *BreakStatement, *ContinueStatement, *Identifier, *IntegerLiteral,
+		*FloatLiteral, *Boolean, *StringLiteral, *Comment:
+		// no children
+
+	case *ArrayPattern:
+		walkExpressions(v, n.Elements)
+		walk(v, n.Rest)
+
+	case *HashPattern:
+		for _, key := range n.Keys {
+			walk(v, key)
+		}
+
+	case *PrefixExpression:
+		walk(v, n.Right)
+
+	case *InfixExpression:
+		walk(v, n.Left)
+		walk(v, n.Right)
+
+	case *LogicalExpression:
+		walk(v, n.Left)
+		walk(v, n.Right)
+
+	case *AssignExpression:
+		walk(v, n.Target)
+		walk(v, n.Value)
+
+	case *IfExpression:
+		walk(v, n.Condition)
+		walk(v, n.Consequence)
+		walk(v, n.Alternative)
+
+	case *MatchExpression:
+		walk(v, n.Subject)
+		for _, arm := range n.Arms {
+			walkExpressions(v, arm.Patterns)
+			walk(v, arm.Body)
+		}
+
+	case *TryExpression:
+		walk(v, n.Block)
+		if n.Catch != nil {
+			walk(v, n.Parameter)
+			walk(v, n.Catch)
+		}
+		walk(v, n.Finally)
+
+	case *FunctionLiteral:
+		for _, parameter := range n.Parameters {
+			if parameter.Pattern != nil {
+				walk(v, parameter.Pattern)
+			} else {
+				walk(v, parameter.Name)
+			}
+			walk(v, parameter.Default)
+		}
+		walk(v, n.Rest)
+		walk(v, n.Body)
+
+	case *MacroLiteral:
+		for _, parameter := range n.Parameters {
+			walk(v, parameter)
+		}
+		walk(v, n.Body)
+
+	case *SpreadExpression:
+		walk(v, n.Value)
+
+	case *CallExpression:
+		walk(v, n.Function)
+		walkExpressions(v, n.Arguments)
+
+	case *ArrayLiteral:
+		walkExpressions(v, n.Elements)
+
+	case *IndexExpression:
+		walk(v, n.Left)
+		walk(v, n.Index)
+
+	case *HashLiteral:
+		for _, pair := range n.Pairs {
+			walk(v, pair.Key)
+			walk(v, pair.Value)
+		}
+
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+// walk walks node, which may be nil, in a field of type T. Nil children,
+// such as a missing condition in a tree built by hand, are skipped.
+func walk[T Node](v Visitor, node T) {
+	var none T
+	if Node(node) == Node(none) {
+		return
+	}
+	Walk(v, node)
+}
+
+func walkStatements(v Visitor, statements []Statement) {
+	for _, statement := range statements {
+		walk(v, statement)
+	}
+}
+
+func walkExpressions(v Visitor, expressions []Expression) {
+	for _, expression := range expressions {
+		walk(v, expression)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses an AST in depth-first order like Walk. It starts by
+// calling f(node); if f returns true, Inspect inspects each of the
+// children of node, followed by a call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// ModifierFunc returns the node that replaces node in the tree.
+type ModifierFunc func(node Node) Node
+
+// Modify rewrites an AST from the bottom up: the children of node are
+// replaced first, then node is replaced by modifier(node). Nodes are
+// changed in place and the result of the outermost call is returned.
+//
+// A replacement that does not fit where its node was, such as an
+// expression returned for a statement or a literal for a parameter name,
+// is ignored and the node is kept.
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch n := node.(type) {
+	case *Program:
+		modifyStatements(n.Statements, modifier)
+
+	case *LetStatement:
+		n.Name = modify(n.Name, modifier)
+		n.Pattern = modify(n.Pattern, modifier)
+		n.Value = modify(n.Value, modifier)
+
+	case *ReturnStatement:
+		n.ReturnValue = modify(n.ReturnValue, modifier)
+
+	case *WhileStatement:
+		n.Condition = modify(n.Condition, modifier)
+		n.Body = modify(n.Body, modifier)
+
+	case *ForStatement:
+		n.Variable = modify(n.Variable, modifier)
+		n.Iterable = modify(n.Iterable, modifier)
+		n.Body = modify(n.Body, modifier)
+
+	case *ExpressionStatement:
+		n.Expression = modify(n.Expression, modifier)
+
+	case *BlockStatement:
+		modifyStatements(n.Statements, modifier)
+
+	case *ArrayPattern:
+		modifyExpressions(n.Elements, modifier)
+		n.Rest = modify(n.Rest, modifier)
+
+	case *HashPattern:
+		for i, key := range n.Keys {
+			n.Keys[i] = modify(key, modifier)
+		}
+
+	case *PrefixExpression:
+		n.Right = modify(n.Right, modifier)
+
+	case *InfixExpression:
+		n.Left = modify(n.Left, modifier)
+		n.Right = modify(n.Right, modifier)
+
+	case *LogicalExpression:
+		n.Left = modify(n.Left, modifier)
+		n.Right = modify(n.Right, modifier)
+
+	case *AssignExpression:
+		n.Target = modify(n.Target, modifier)
+		n.Value = modify(n.Value, modifier)
+
+	case *IfExpression:
+		n.Condition = modify(n.Condition, modifier)
+		n.Consequence = modify(n.Consequence, modifier)
+		n.Alternative = modify(n.Alternative, modifier)
+
+	case *MatchExpression:
+		n.Subject = modify(n.Subject, modifier)
+		for _, arm := range n.Arms {
+			modifyExpressions(arm.Patterns, modifier)
+			arm.Body = modify(arm.Body, modifier)
+		}
+
+	case *TryExpression:
+		n.Block = modify(n.Block, modifier)
+		n.Parameter = modify(n.Parameter, modifier)
+		n.Catch = modify(n.Catch, modifier)
+		n.Finally = modify(n.Finally, modifier)
+
+	case *FunctionLiteral:
+		for _, parameter := range n.Parameters {
+			parameter.Name = modify(parameter.Name, modifier)
+			parameter.Pattern = modify(parameter.Pattern, modifier)
+			parameter.Default = modify(parameter.Default, modifier)
+		}
+		n.Rest = modify(n.Rest, modifier)
+		n.Body = modify(n.Body, modifier)
+
+	case *MacroLiteral:
+		for i, parameter := range n.Parameters {
+			n.Parameters[i] = modify(parameter, modifier)
+		}
+		n.Body = modify(n.Body, modifier)
+
+	case *SpreadExpression:
+		n.Value = modify(n.Value, modifier)
+
+	case *CallExpression:
+		n.Function = modify(n.Function, modifier)
+		modifyExpressions(n.Arguments, modifier)
+
+	case *ArrayLiteral:
+		modifyExpressions(n.Elements, modifier)
+
+	case *IndexExpression:
+		n.Left = modify(n.Left, modifier)
+		n.Index = modify(n.Index, modifier)
+
+	case *HashLiteral:
+		for _, pair := range n.Pairs {
+			pair.Key = modify(pair.Key, modifier)
+			pair.Value = modify(pair.Value, modifier)
+		}
+	}
+
+	return modifier(node)
+}
+
+// modify replaces node, which may be nil, in a field of type T.
+func modify[T Node](node T, modifier ModifierFunc) T {
+	var none T
+	if Node(node) == Node(none) {
+		return node
+	}
+	if modified, ok := Modify(node, modifier).(T); ok {
+		return modified
+	}
+	return node
+}
+
+func modifyStatements(statements []Statement, modifier ModifierFunc) {
+	for i, statement := range statements {
+		statements[i] = modify(statement, modifier)
+	}
+}
+
+func modifyExpressions(expressions []Expression, modifier ModifierFunc) {
+	for i, expression := range expressions {
+		expressions[i] = modify(expression, modifier)
+	}
+}
+
+// Copy returns a deep copy of node, which can be modified without
+// changing node.
+func Copy(node Node) Node {
+	if node == nil {
+		return nil
+	}
+	return copyValue(reflect.ValueOf(node)).Interface().(Node)
+}
+
+func copyValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		if v.Kind() == reflect.Pointer {
+			c := reflect.New(v.Type().Elem())
+			c.Elem().Set(copyValue(v.Elem()))
+			return c
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(copyValue(v.Elem()))
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			c.Field(i).Set(copyValue(v.Field(i)))
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(copyValue(v.Index(i)))
+		}
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(copyValue(iter.Key()), copyValue(iter.Value()))
+		}
+		return c
+	default:
+		return v
+	}
+}
@@ -0,0 +1,221 @@
+package ast_test
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"strings"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1 + 2;", "Let Ident(x) Infix(+) Int(1) Int(2)"},
+		{"let [a, ...b] = c;", "Let ArrayPattern Ident(a) Ident(b) Ident(c)"},
+		{"let {a, b} = c;", "Let HashPattern Ident(a) Ident(b) Ident(c)"},
+		{"return -x;", "Return Prefix(-) Ident(x)"},
+		{"if (a) { b } else { c }", "Expr If Ident(a) Block Expr Ident(b) Block Expr Ident(c)"},
+		{"fn(a, [b], c = 1, ...d) { a }", "Expr Fn Ident(a) ArrayPattern Ident(b) Ident(c) Int(1) Ident(d) Block Expr Ident(a)"},
+		{"f(1, ...xs)", "Expr Call Ident(f) Int(1) Spread Ident(xs)"},
+		{"[1, 2][0]", "Expr Index Array Int(1) Int(2) Int(0)"},
+		{`{"a": 1, "b": 2}`, "Expr Hash Str(a) Int(1) Str(b) Int(2)"},
+		{"a && b", "Expr Logical(&&) Ident(a) Ident(b)"},
+		{"a[0] += 1", "Expr Assign(+=) Index Ident(a) Int(0) Int(1)"},
+		{"while (true) { break; }", "While Bool(true) Block Break"},
+		{"for (x in xs) { continue; }", "For Ident(x) Ident(xs) Block Continue"},
+		{`match (x) { 1, [_] => 2.5, _ => "s" }`, "Expr Match Ident(x) Int(1) Array Ident(_) Block Expr Float(2.5) Ident(_) Block Expr Str(s)"},
+		{"try { a } catch (e) { b } finally { c }", "Expr Try Block Expr Ident(a) Ident(e) Block Expr Ident(b) Block Expr Ident(c)"},
+		{"macro(a) { quote(a) }", "Expr Macro Ident(a) Block Expr Call Ident(quote) Ident(a)"},
+	}
+
+	for _, tt := range tests {
+		var nodes []string
+		ast.Inspect(parse(t, tt.input), func(node ast.Node) bool {
+			if node != nil {
+				if _, ok := node.(*ast.Program); !ok {
+					nodes = append(nodes, describe(node))
+				}
+			}
+			return true
+		})
+		if actual := strings.Join(nodes, " "); actual != tt.expected {
+			t.Errorf("%s: wrong nodes.\nexpected=%q\ngot=     %q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestInspectSkipsChildren(t *testing.T) {
+	var identifiers []string
+	ast.Inspect(parse(t, "let f = fn(a) { b }; f(c)"), func(node ast.Node) bool {
+		if identifier, ok := node.(*ast.Identifier); ok {
+			identifiers = append(identifiers, identifier.Value)
+		}
+		_, ok := node.(*ast.FunctionLiteral)
+		return !ok
+	})
+
+	if actual := strings.Join(identifiers, " "); actual != "f f c" {
+		t.Errorf("wrong identifiers. expected=%q, got=%q", "f f c", actual)
+	}
+}
+
+// depthVisitor records the depth of every node and checks that each call
+// with a node is matched by a call with nil once its children are done.
+type depthVisitor struct {
+	depth  *int
+	depths *[]int
+}
+
+func (v depthVisitor) Visit(node ast.Node) ast.Visitor {
+	if node == nil {
+		*v.depth--
+		return nil
+	}
+	*v.depths = append(*v.depths, *v.depth)
+	*v.depth++
+	return v
+}
+
+func TestWalk(t *testing.T) {
+	depth := 0
+	var depths []int
+	ast.Walk(depthVisitor{&depth, &depths}, parse(t, "let x = f(1);"))
+
+	expected := []int{0, 1, 2, 2, 3, 3}
+	if fmt.Sprint(depths) != fmt.Sprint(expected) {
+		t.Errorf("wrong depths. expected=%v, got=%v", expected, depths)
+	}
+	if depth != 0 {
+		t.Errorf("Visit(nil) not called for every node. depth=%d", depth)
+	}
+}
+
+func TestInspectPartialTrees(t *testing.T) {
+	tests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{&ast.Comment{}, "Comment"},
+		{&ast.WhileStatement{}, "While"},
+		{&ast.WhileStatement{Body: &ast.BlockStatement{}}, "While Block"},
+		{&ast.ForStatement{Iterable: &ast.Identifier{Value: "xs"}}, "For Ident(xs)"},
+		{&ast.IfExpression{Alternative: &ast.BlockStatement{}}, "If Block"},
+		{&ast.InfixExpression{Operator: "+", Right: &ast.Identifier{Value: "b"}}, "Infix(+) Ident(b)"},
+		{&ast.CallExpression{Arguments: []ast.Expression{nil, &ast.Identifier{Value: "a"}}}, "Call Ident(a)"},
+		{&ast.FunctionLiteral{Parameters: []*ast.Parameter{{}}}, "Fn"},
+	}
+
+	for _, tt := range tests {
+		var nodes []string
+		ast.Inspect(tt.node, func(node ast.Node) bool {
+			if node != nil {
+				nodes = append(nodes, describe(node))
+			}
+			return true
+		})
+		if actual := strings.Join(nodes, " "); actual != tt.expected {
+			t.Errorf("%T: wrong nodes. expected=%q, got=%q", tt.node, tt.expected, actual)
+		}
+	}
+}
+
+func TestCopy(t *testing.T) {
+	program := parse(t, `let f = fn(a, b = 1) { [a, {"k": b}][0] }; match (f(1)) { 1 => true }`)
+	copied := ast.Copy(program)
+	if copied.String() != program.String() {
+		t.Fatalf("copy differs. expected=%q, got=%q", program.String(), copied.String())
+	}
+
+	ast.Modify(copied, func(node ast.Node) ast.Node {
+		if integer, ok := node.(*ast.IntegerLiteral); ok {
+			integer.Value = 2
+			integer.Token.Literal = "2"
+		}
+		return node
+	})
+	if strings.Contains(program.String(), "2") {
+		t.Errorf("modifying the copy changed the original: %s", program.String())
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.ParseErrors()) > 0 {
+		t.Fatalf("%s: parse errors: %v", input, p.ParseErrors())
+	}
+	return program
+}
+
+func describe(node ast.Node) string {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		return "Let"
+	case *ast.ReturnStatement:
+		return "Return"
+	case *ast.WhileStatement:
+		return "While"
+	case *ast.ForStatement:
+		return "For"
+	case *ast.BreakStatement:
+		return "Break"
+	case *ast.ContinueStatement:
+		return "Continue"
+	case *ast.ExpressionStatement:
+		return "Expr"
+	case *ast.BlockStatement:
+		return "Block"
+	case *ast.ArrayPattern:
+		return "ArrayPattern"
+	case *ast.HashPattern:
+		return "HashPattern"
+	case *ast.Identifier:
+		return "Ident(" + node.Value + ")"
+	case *ast.IntegerLiteral:
+		return "Int(" + node.String() + ")"
+	case *ast.FloatLiteral:
+		return "Float(" + node.String() + ")"
+	case *ast.Boolean:
+		return "Bool(" + node.String() + ")"
+	case *ast.StringLiteral:
+		return "Str(" + node.Value + ")"
+	case *ast.PrefixExpression:
+		return "Prefix(" + node.Operator + ")"
+	case *ast.InfixExpression:
+		return "Infix(" + node.Operator + ")"
+	case *ast.LogicalExpression:
+		return "Logical(" + node.Operator + ")"
+	case *ast.AssignExpression:
+		return "Assign(" + node.Operator + ")"
+	case *ast.IfExpression:
+		return "If"
+	case *ast.MatchExpression:
+		return "Match"
+	case *ast.TryExpression:
+		return "Try"
+	case *ast.FunctionLiteral:
+		return "Fn"
+	case *ast.MacroLiteral:
+		return "Macro"
+	case *ast.SpreadExpression:
+		return "Spread"
+	case *ast.CallExpression:
+		return "Call"
+	case *ast.ArrayLiteral:
+		return "Array"
+	case *ast.IndexExpression:
+		return "Index"
+	case *ast.HashLiteral:
+		return "Hash"
+	case *ast.Comment:
+		return "Comment"
+	default:
+		return fmt.Sprintf("%T", node)
+	}
+}
@@ -0,0 +1,307 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"monkey/token"
+	"sort"
+)
+
+type Instructions []byte
+
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+		i += 1 + read
+	}
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), operandCount)
+	}
+
+	out := def.Name
+	for _, operand := range operands {
+		out += fmt.Sprintf(" %d", operand)
+	}
+	return out
+}
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota
+	OpPop
+	OpDup
+	OpSwap
+	OpTrue
+	OpFalse
+	OpNull
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpLessThan
+	OpGreaterEqual
+	OpLessEqual
+	OpMinus
+	OpBang
+	OpBool
+
+	OpJump
+	OpJumpNotTruthy
+
+	OpGetGlobal
+	OpSetGlobal
+	OpAssignGlobal
+	OpGetLocal
+	OpSetLocal
+	OpGetFree
+	OpSetFree
+	OpGetBuiltin
+
+	OpArray
+	OpHash
+	OpAppend
+	OpSpreadAppend
+	OpIndex
+	OpSetIndex
+
+	OpCall
+	OpTailCall
+	OpCallSpread
+	OpReturnValue
+
+	OpClosure
+	OpCaptureLocal
+	OpCaptureFree
+	OpCloseUpvalues
+	OpJumpIfArg
+
+	OpIterInit
+	OpIterNext
+
+	OpMatchEqual
+	OpMatchLength
+	OpDestructureArray
+	OpDestructureHash
+
+	OpTry
+	OpEndTry
+	OpCatch
+	OpThrow
+)
+
+// Definition describes an opcode: its name for disassembly and the width
+// in bytes of each of its operands.
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+	OpDup:      {"OpDup", []int{}},
+	OpSwap:     {"OpSwap", []int{}},
+	OpTrue:     {"OpTrue", []int{}},
+	OpFalse:    {"OpFalse", []int{}},
+	OpNull:     {"OpNull", []int{}},
+
+	OpAdd:          {"OpAdd", []int{}},
+	OpSub:          {"OpSub", []int{}},
+	OpMul:          {"OpMul", []int{}},
+	OpDiv:          {"OpDiv", []int{}},
+	OpMod:          {"OpMod", []int{}},
+	OpEqual:        {"OpEqual", []int{}},
+	OpNotEqual:     {"OpNotEqual", []int{}},
+	OpGreaterThan:  {"OpGreaterThan", []int{}},
+	OpLessThan:     {"OpLessThan", []int{}},
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},
+	OpLessEqual:    {"OpLessEqual", []int{}},
+	OpMinus:        {"OpMinus", []int{}},
+	OpBang:         {"OpBang", []int{}},
+	// OpBool replaces the top of the stack with its truthiness.
+	OpBool: {"OpBool", []int{}},
+
+	OpJump:          {"OpJump", []int{2}},
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+
+	OpGetGlobal: {"OpGetGlobal", []int{2}},
+	OpSetGlobal: {"OpSetGlobal", []int{2}},
+	// OpAssignGlobal is OpSetGlobal for assignments, which fail when the
+	// global was never defined.
+	OpAssignGlobal: {"OpAssignGlobal", []int{2}},
+	OpGetLocal:     {"OpGetLocal", []int{2}},
+	OpSetLocal:     {"OpSetLocal", []int{2}},
+	OpGetFree:      {"OpGetFree", []int{1}},
+	OpSetFree:      {"OpSetFree", []int{1}},
+	OpGetBuiltin:   {"OpGetBuiltin", []int{1}},
+
+	OpArray: {"OpArray", []int{2}},
+	OpHash:  {"OpHash", []int{2}},
+	// OpAppend and OpSpreadAppend add an element, or all elements of an
+	// array, to the array below the top of the stack.
+	OpAppend:       {"OpAppend", []int{}},
+	OpSpreadAppend: {"OpSpreadAppend", []int{}},
+	OpIndex:        {"OpIndex", []int{}},
+	// OpSetIndex takes the opcode of a compound assignment operator, or
+	// zero for plain assignment.
+	OpSetIndex: {"OpSetIndex", []int{1}},
+
+	OpCall:     {"OpCall", []int{1}},
+	OpTailCall: {"OpTailCall", []int{1}},
+	// OpCallSpread calls a function with the elements of an array as the
+	// arguments. Its operand is 1 for calls in tail position.
+	OpCallSpread:  {"OpCallSpread", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+
+	// OpClosure takes the constant index of the function and the number
+	// of captured variables, which OpCaptureLocal and OpCaptureFree push
+	// beforehand.
+	OpClosure:      {"OpClosure", []int{2, 1}},
+	OpCaptureLocal: {"OpCaptureLocal", []int{2}},
+	OpCaptureFree:  {"OpCaptureFree", []int{1}},
+	// OpCloseUpvalues closes the captured variables in a range of local
+	// slots, given by the first slot and the number of slots.
+	OpCloseUpvalues: {"OpCloseUpvalues", []int{2, 2}},
+	// OpJumpIfArg skips the default value of a parameter that was passed.
+	OpJumpIfArg: {"OpJumpIfArg", []int{1, 2}},
+
+	OpIterInit: {"OpIterInit", []int{}},
+	// OpIterNext pushes the next item of the iterator on top of the stack,
+	// or jumps once it is exhausted.
+	OpIterNext: {"OpIterNext", []int{2}},
+
+	OpMatchEqual:  {"OpMatchEqual", []int{}},
+	OpMatchLength: {"OpMatchLength", []int{2}},
+	// OpDestructureArray takes the number of elements, 1 when there is a
+	// rest element and the constant index of the pattern's source text.
+	OpDestructureArray: {"OpDestructureArray", []int{2, 1, 2}},
+	// OpDestructureHash takes the constant indexes of the array of keys
+	// and of the pattern's source text.
+	OpDestructureHash: {"OpDestructureHash", []int{2, 2}},
+
+	// OpTry installs a handler that catches errors until the matching
+	// OpEndTry. On an error the stack is reset, the error pushed and
+	// execution continues at the operand.
+	OpTry:    {"OpTry", []int{2}},
+	OpEndTry: {"OpEndTry", []int{}},
+	OpCatch:  {"OpCatch", []int{}},
+	OpThrow:  {"OpThrow", []int{}},
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+	return instruction
+}
+
+// CheckOperands reports an error if an operand does not fit in the width
+// op defines for it, in which case Make would silently truncate it.
+func CheckOperands(op Opcode, operands ...int) error {
+	def, err := Lookup(byte(op))
+	if err != nil {
+		return err
+	}
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		if o < 0 || o >= 1<<(8*width) {
+			return fmt.Errorf("operand %d of %s does not fit in %d bytes", o, def.Name, width)
+		}
+	}
+	return nil
+}
+
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += width
+	}
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
+
+// LineEntry maps the instructions from Offset up to the next entry to the
+// source position they were compiled from.
+type LineEntry struct {
+	Offset int
+	Pos    token.Position
+}
+
+// LineTable lists line entries in ascending offset order.
+type LineTable []LineEntry
+
+// Lookup returns the source position of the instruction at offset.
+func (lt LineTable) Lookup(offset int) token.Position {
+	i := sort.Search(len(lt), func(i int) bool { return lt[i].Offset > offset })
+	if i == 0 {
+		return token.Position{}
+	}
+	return lt[i-1].Pos
+}
@@ -0,0 +1,123 @@
+package code
+
+import (
+	"monkey/token"
+	"testing"
+)
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected []byte
+	}{
+		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
+		{OpAdd, []int{}, []byte{byte(OpAdd)}},
+		{OpGetLocal, []int{258}, []byte{byte(OpGetLocal), 1, 2}},
+		{OpClosure, []int{65534, 255}, []byte{byte(OpClosure), 255, 254, 255}},
+		{OpDestructureArray, []int{2, 1, 3}, []byte{byte(OpDestructureArray), 0, 2, 1, 0, 3}},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		if len(instruction) != len(tt.expected) {
+			t.Errorf("instruction has wrong length. want=%d, got=%d", len(tt.expected), len(instruction))
+			continue
+		}
+		for i, b := range tt.expected {
+			if instruction[i] != b {
+				t.Errorf("wrong byte at pos %d. want=%d, got=%d", i, b, instruction[i])
+			}
+		}
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	instructions := []Instructions{
+		Make(OpAdd),
+		Make(OpGetLocal, 1),
+		Make(OpConstant, 2),
+		Make(OpConstant, 65535),
+		Make(OpClosure, 65535, 255),
+		Make(OpJumpIfArg, 1, 12),
+	}
+
+	expected := `0000 OpAdd
+0001 OpGetLocal 1
+0004 OpConstant 2
+0007 OpConstant 65535
+0010 OpClosure 65535 255
+0014 OpJumpIfArg 1 12
+`
+
+	concatted := Instructions{}
+	for _, ins := range instructions {
+		concatted = append(concatted, ins...)
+	}
+
+	if concatted.String() != expected {
+		t.Errorf("instructions wrongly formatted.\nwant=%q\ngot=%q", expected, concatted.String())
+	}
+}
+
+func TestReadOperands(t *testing.T) {
+	tests := []struct {
+		op        Opcode
+		operands  []int
+		bytesRead int
+	}{
+		{OpConstant, []int{65535}, 2},
+		{OpGetFree, []int{255}, 1},
+		{OpClosure, []int{65535, 255}, 3},
+		{OpDestructureHash, []int{4, 5}, 4},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		def, err := Lookup(byte(tt.op))
+		if err != nil {
+			t.Fatalf("definition not found: %q\n", err)
+		}
+
+		operandsRead, n := ReadOperands(def, instruction[1:])
+		if n != tt.bytesRead {
+			t.Fatalf("n wrong. want=%d, got=%d", tt.bytesRead, n)
+		}
+		for i, want := range tt.operands {
+			if operandsRead[i] != want {
+				t.Errorf("operand wrong. want=%d, got=%d", want, operandsRead[i])
+			}
+		}
+	}
+}
+
+func TestLineTableLookup(t *testing.T) {
+	table := LineTable{
+		{Offset: 0, Pos: token.Position{Line: 1, Column: 1}},
+		{Offset: 4, Pos: token.Position{Line: 2, Column: 3}},
+		{Offset: 9, Pos: token.Position{Line: 3, Column: 5}},
+	}
+
+	tests := []struct {
+		offset   int
+		expected string
+	}{
+		{0, "1:1"},
+		{3, "1:1"},
+		{4, "2:3"},
+		{8, "2:3"},
+		{20, "3:5"},
+	}
+
+	for _, tt := range tests {
+		if pos := table.Lookup(tt.offset); pos.String() != tt.expected {
+			t.Errorf("wrong position for offset %d. want=%s, got=%s", tt.offset, tt.expected, pos)
+		}
+	}
+
+	if pos := (LineTable{}).Lookup(0); pos.IsValid() {
+		t.Errorf("empty table returned a position: %s", pos)
+	}
+}
@@ -0,0 +1,942 @@
+package compiler
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/code"
+	"monkey/object"
+	"monkey/token"
+	"strings"
+)
+
+// Bytecode is a compiled program. Main holds the instructions of the
+// program itself; it returns the value of the last statement.
+type Bytecode struct {
+	Main      *object.CompiledFunction
+	Constants []object.Object
+	Globals   []string // names of the global slots
+}
+
+type CompilationScope struct {
+	instructions code.Instructions
+	positions    code.LineTable
+	loops        []*loop
+	tries        []*tryBlock
+}
+
+// loop collects the jumps out of a loop body that are patched once the
+// loop has been compiled.
+type loop struct {
+	breaks    []int
+	continues []int
+	tries     int // try blocks open outside the loop
+}
+
+// tryBlock is a try or catch block being compiled. Leaving it early with
+// return, break or continue removes its handler and runs its finally block.
+type tryBlock struct {
+	handler bool
+	finally *ast.BlockStatement
+}
+
+type Compiler struct {
+	constants   []object.Object
+	symbolTable *SymbolTable
+	scopes      []CompilationScope
+	scopeIndex  int
+
+	// pos is the position of the node being compiled, recorded in the
+	// line table for the instructions emitted for it.
+	pos token.Position
+
+	// err is set when an emitted operand does not fit in its instruction,
+	// for example in a program with too many constants or a jump too far.
+	err error
+}
+
+var infixOperators = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"%":  code.OpMod,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	">":  code.OpGreaterThan,
+	"<":  code.OpLessThan,
+	">=": code.OpGreaterEqual,
+	"<=": code.OpLessEqual,
+}
+
+func New() *Compiler {
+	symbolTable := NewSymbolTable()
+	for i, def := range object.Builtins {
+		symbolTable.DefineBuiltin(i, def.Name)
+	}
+
+	return &Compiler{
+		symbolTable: symbolTable,
+		scopes:      []CompilationScope{{}},
+	}
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	scope := c.scopes[0]
+	return &Bytecode{
+		Main: &object.CompiledFunction{
+			Instructions: scope.instructions,
+			NumLocals:    c.symbolTable.NumLocals(),
+			Positions:    scope.positions,
+			LocalNames:   c.symbolTable.LocalNames(),
+		},
+		Constants: c.constants,
+		Globals:   c.symbolTable.GlobalNames(),
+	}
+}
+
+func (c *Compiler) Compile(node ast.Node) error {
+	prev := c.pos
+	c.pos = node.Pos()
+	defer func() { c.pos = prev }()
+
+	if err := c.compile(node); err != nil {
+		return err
+	}
+	return c.err
+}
+
+func (c *Compiler) compile(node ast.Node) error {
+	switch node := node.(type) {
+	case *ast.Program:
+		if err := c.compileBlockValue(node.Statements); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+	case *ast.ExpressionStatement:
+		if err := c.Compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+	case *ast.BlockStatement:
+		return c.compileBlockValue(node.Statements)
+	case *ast.IntegerLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: node.Value}))
+	case *ast.FloatLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Float{Value: node.Value}))
+	case *ast.StringLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: node.Value}))
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+	case *ast.PrefixExpression:
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+	case *ast.InfixExpression:
+		op, ok := infixOperators[node.Operator]
+		if !ok {
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		c.emit(op)
+	case *ast.LogicalExpression:
+		return c.compileLogicalExpression(node)
+	case *ast.AssignExpression:
+		return c.compileAssignExpression(node)
+	case *ast.IfExpression:
+		return c.compileIfExpression(node)
+	case *ast.MatchExpression:
+		return c.compileMatchExpression(node)
+	case *ast.TryExpression:
+		return c.compileTryExpression(node)
+	case *ast.WhileStatement:
+		return c.compileWhileStatement(node)
+	case *ast.ForStatement:
+		return c.compileForStatement(node)
+	case *ast.BreakStatement:
+		return c.compileLoopJump(true)
+	case *ast.ContinueStatement:
+		return c.compileLoopJump(false)
+	case *ast.ReturnStatement:
+		if err := c.Compile(node.ReturnValue); err != nil {
+			return err
+		}
+		if err := c.leaveTryBlocks(0); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+	case *ast.LetStatement:
+		return c.compileLetStatement(node)
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			// Names defined nowhere are globals that are never set; using
+			// them is an error at run time, as in the evaluator.
+			symbol = c.symbolTable.global().Define(node.Value)
+		}
+		c.loadSymbol(symbol)
+	case *ast.FunctionLiteral:
+		return c.compileFunctionLiteral(node)
+	case *ast.CallExpression:
+		return c.compileCallExpression(node)
+	case *ast.MacroLiteral:
+		return fmt.Errorf("macro literals must be bound with a top-level let statement")
+	case *ast.ArrayLiteral:
+		return c.compileElements(node.Elements)
+	case *ast.HashLiteral:
+		for _, pair := range node.Pairs {
+			if err := c.Compile(pair.Key); err != nil {
+				return err
+			}
+			if err := c.Compile(pair.Value); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(node.Pairs)*2)
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+	default:
+		return fmt.Errorf("cannot compile %T", node)
+	}
+	return nil
+}
+
+// compileStatements compiles statements that leave nothing on the stack.
+func (c *Compiler) compileStatements(statements []ast.Statement) error {
+	for _, s := range statements {
+		if err := c.Compile(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileBlockValue compiles statements so that they leave the value of
+// the last one on the stack, or null if it is not an expression.
+func (c *Compiler) compileBlockValue(statements []ast.Statement) error {
+	if len(statements) == 0 {
+		c.emit(code.OpNull)
+		return nil
+	}
+
+	last := len(statements) - 1
+	if err := c.compileStatements(statements[:last]); err != nil {
+		return err
+	}
+	if statement, ok := statements[last].(*ast.ExpressionStatement); ok {
+		return c.Compile(statement.Expression)
+	}
+	if err := c.Compile(statements[last]); err != nil {
+		return err
+	}
+	c.emit(code.OpNull)
+	return nil
+}
+
+func (c *Compiler) compileLogicalExpression(node *ast.LogicalExpression) error {
+	if err := c.Compile(node.Left); err != nil {
+		return err
+	}
+
+	jumpNotTruthy := c.emit(code.OpJumpNotTruthy, 9999)
+	switch node.Operator {
+	case "&&":
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		c.emit(code.OpBool)
+		jump := c.emit(code.OpJump, 9999)
+		c.changeOperand(jumpNotTruthy, len(c.currentInstructions()))
+		c.emit(code.OpFalse)
+		c.changeOperand(jump, len(c.currentInstructions()))
+	case "||":
+		c.emit(code.OpTrue)
+		jump := c.emit(code.OpJump, 9999)
+		c.changeOperand(jumpNotTruthy, len(c.currentInstructions()))
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		c.emit(code.OpBool)
+		c.changeOperand(jump, len(c.currentInstructions()))
+	default:
+		return fmt.Errorf("unknown operator %s", node.Operator)
+	}
+	return nil
+}
+
+func (c *Compiler) compileAssignExpression(node *ast.AssignExpression) error {
+	var op code.Opcode
+	if node.Operator != "=" {
+		var ok bool
+		op, ok = infixOperators[strings.TrimSuffix(node.Operator, "=")]
+		if !ok {
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+	}
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(target.Value)
+		if !ok {
+			symbol = c.symbolTable.global().Define(target.Value)
+		}
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		if op != 0 {
+			c.loadSymbol(symbol)
+			c.emit(code.OpSwap)
+			c.emit(op)
+		}
+		c.emit(code.OpDup)
+		switch symbol.Scope {
+		case GlobalScope:
+			c.emit(code.OpAssignGlobal, symbol.Index)
+		case LocalScope:
+			c.emit(code.OpSetLocal, symbol.Index)
+		case FreeScope:
+			c.emit(code.OpSetFree, symbol.Index)
+		case BuiltinScope:
+			c.emit(code.OpAssignGlobal, c.symbolTable.DefineUnbound(target.Value).Index)
+		}
+	case *ast.IndexExpression:
+		if err := c.Compile(target.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(target.Index); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpSetIndex, int(op))
+	default:
+		return fmt.Errorf("cannot assign to %s", node.Target.String())
+	}
+	return nil
+}
+
+func (c *Compiler) compileIfExpression(node *ast.IfExpression) error {
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+
+	jumpNotTruthy := c.emit(code.OpJumpNotTruthy, 9999)
+	if err := c.Compile(node.Consequence); err != nil {
+		return err
+	}
+	jump := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(jumpNotTruthy, len(c.currentInstructions()))
+	if node.Alternative == nil {
+		c.emit(code.OpNull)
+	} else if err := c.Compile(node.Alternative); err != nil {
+		return err
+	}
+	c.changeOperand(jump, len(c.currentInstructions()))
+	return nil
+}
+
+func (c *Compiler) compileMatchExpression(node *ast.MatchExpression) error {
+	if err := c.Compile(node.Subject); err != nil {
+		return err
+	}
+	subject := c.symbolTable.DefineHidden()
+	c.emit(code.OpSetLocal, subject.Index)
+	load := func() { c.emit(code.OpGetLocal, subject.Index) }
+
+	var ends []int
+	for _, arm := range node.Arms {
+		var matches []int
+		for _, pattern := range arm.Patterns {
+			if err := c.compilePattern(pattern, load); err != nil {
+				return err
+			}
+			jumpNotTruthy := c.emit(code.OpJumpNotTruthy, 9999)
+			matches = append(matches, c.emit(code.OpJump, 9999))
+			c.changeOperand(jumpNotTruthy, len(c.currentInstructions()))
+		}
+		nextArm := c.emit(code.OpJump, 9999)
+
+		for _, match := range matches {
+			c.changeOperand(match, len(c.currentInstructions()))
+		}
+		if err := c.Compile(arm.Body); err != nil {
+			return err
+		}
+		ends = append(ends, c.emit(code.OpJump, 9999))
+		c.changeOperand(nextArm, len(c.currentInstructions()))
+	}
+
+	c.emit(code.OpNull)
+	for _, end := range ends {
+		c.changeOperand(end, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+// compilePattern emits code that pushes whether the value pushed by load
+// matches pattern.
+func (c *Compiler) compilePattern(pattern ast.Expression, load func()) error {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			return fmt.Errorf("invalid pattern %s", pattern.Value)
+		}
+		c.emit(code.OpTrue)
+	case *ast.ArrayLiteral:
+		load()
+		c.emit(code.OpMatchLength, len(pattern.Elements))
+		fails := []int{c.emit(code.OpJumpNotTruthy, 9999)}
+		for i, element := range pattern.Elements {
+			index := c.addConstant(&object.Integer{Value: int64(i)})
+			loadElement := func() {
+				load()
+				c.emit(code.OpConstant, index)
+				c.emit(code.OpIndex)
+			}
+			if err := c.compilePattern(element, loadElement); err != nil {
+				return err
+			}
+			fails = append(fails, c.emit(code.OpJumpNotTruthy, 9999))
+		}
+		c.emit(code.OpTrue)
+		jump := c.emit(code.OpJump, 9999)
+		for _, fail := range fails {
+			c.changeOperand(fail, len(c.currentInstructions()))
+		}
+		c.emit(code.OpFalse)
+		c.changeOperand(jump, len(c.currentInstructions()))
+	default:
+		if err := c.Compile(pattern); err != nil {
+			return err
+		}
+		load()
+		c.emit(code.OpMatchEqual)
+	}
+	return nil
+}
+
+func (c *Compiler) compileTryExpression(node *ast.TryExpression) error {
+	jumpCatch := c.emit(code.OpTry, 9999)
+	if err := c.compileTryBlock(node.Block, node.Finally); err != nil {
+		return err
+	}
+	if err := c.compileFinally(node.Finally); err != nil {
+		return err
+	}
+	ends := []int{c.emit(code.OpJump, 9999)}
+
+	// Errors land here with the error on the stack.
+	c.changeOperand(jumpCatch, len(c.currentInstructions()))
+	if node.Catch != nil {
+		c.emit(code.OpCatch)
+		c.enterBlockScope()
+		parameter := c.symbolTable.Define(node.Parameter.Value)
+		c.emit(code.OpSetLocal, parameter.Index)
+
+		if node.Finally == nil {
+			err := c.Compile(node.Catch)
+			c.closeUpvalues(parameter.Index)
+			c.leaveBlockScope()
+			c.patchJumps(ends, len(c.currentInstructions()))
+			return err
+		}
+
+		jumpFinally := c.emit(code.OpTry, 9999)
+		err := c.compileTryBlock(node.Catch, node.Finally)
+		c.closeUpvalues(parameter.Index)
+		c.leaveBlockScope()
+		if err != nil {
+			return err
+		}
+		if err := c.compileFinally(node.Finally); err != nil {
+			return err
+		}
+		ends = append(ends, c.emit(code.OpJump, 9999))
+		c.changeOperand(jumpFinally, len(c.currentInstructions()))
+		c.closeUpvalues(parameter.Index)
+	}
+
+	// Run the finally block and raise the error again.
+	thrown := c.symbolTable.DefineHidden()
+	c.emit(code.OpSetLocal, thrown.Index)
+	if err := c.compileFinally(node.Finally); err != nil {
+		return err
+	}
+	c.emit(code.OpGetLocal, thrown.Index)
+	c.emit(code.OpThrow)
+
+	c.patchJumps(ends, len(c.currentInstructions()))
+	return nil
+}
+
+// compileTryBlock compiles a block guarded by the handler installed just
+// before it and removes the handler after it.
+func (c *Compiler) compileTryBlock(block, finally *ast.BlockStatement) error {
+	scope := &c.scopes[c.scopeIndex]
+	scope.tries = append(scope.tries, &tryBlock{handler: true, finally: finally})
+	err := c.Compile(block)
+	scope = &c.scopes[c.scopeIndex]
+	scope.tries = scope.tries[:len(scope.tries)-1]
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpEndTry)
+	return nil
+}
+
+func (c *Compiler) compileFinally(finally *ast.BlockStatement) error {
+	if finally == nil {
+		return nil
+	}
+	if err := c.Compile(finally); err != nil {
+		return err
+	}
+	c.emit(code.OpPop)
+	return nil
+}
+
+// leaveTryBlocks emits the code for jumping out of the try blocks entered
+// after the first depth ones in the current function.
+func (c *Compiler) leaveTryBlocks(depth int) error {
+	tries := c.scopes[c.scopeIndex].tries
+	defer func() { c.scopes[c.scopeIndex].tries = tries }()
+
+	for i := len(tries) - 1; i >= depth; i-- {
+		if tries[i].handler {
+			c.emit(code.OpEndTry)
+		}
+		// The finally block runs outside of the try block.
+		c.scopes[c.scopeIndex].tries = tries[:i]
+		if err := c.compileFinally(tries[i].finally); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) compileWhileStatement(node *ast.WhileStatement) error {
+	start := len(c.currentInstructions())
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+	jumpNotTruthy := c.emit(code.OpJumpNotTruthy, 9999)
+
+	l, err := c.compileLoopBody(node.Body)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpJump, start)
+	end := len(c.currentInstructions())
+
+	c.changeOperand(jumpNotTruthy, end)
+	c.patchJumps(l.continues, start)
+	c.patchJumps(l.breaks, end)
+	return nil
+}
+
+// compileForStatement compiles a for loop. Every iteration gets fresh
+// variables, so variables captured by closures are closed at the end of
+// each iteration.
+func (c *Compiler) compileForStatement(node *ast.ForStatement) error {
+	if err := c.Compile(node.Iterable); err != nil {
+		return err
+	}
+	c.emit(code.OpIterInit)
+	iterator := c.symbolTable.DefineHidden()
+	c.emit(code.OpSetLocal, iterator.Index)
+
+	c.enterBlockScope()
+	defer c.leaveBlockScope()
+	variable := c.symbolTable.Define(node.Variable.Value)
+
+	start := len(c.currentInstructions())
+	c.emit(code.OpGetLocal, iterator.Index)
+	jumpDone := c.emit(code.OpIterNext, 9999)
+	c.emit(code.OpSetLocal, variable.Index)
+
+	l, err := c.compileLoopBody(node.Body)
+	if err != nil {
+		return err
+	}
+	next := len(c.currentInstructions())
+	c.closeUpvalues(variable.Index)
+	c.emit(code.OpJump, start)
+	end := len(c.currentInstructions())
+	c.closeUpvalues(variable.Index)
+
+	c.changeOperand(jumpDone, end)
+	c.patchJumps(l.continues, next)
+	c.patchJumps(l.breaks, end)
+	return nil
+}
+
+func (c *Compiler) compileLoopBody(body *ast.BlockStatement) (*loop, error) {
+	scope := &c.scopes[c.scopeIndex]
+	l := &loop{tries: len(scope.tries)}
+	scope.loops = append(scope.loops, l)
+
+	err := c.compileStatements(body.Statements)
+
+	scope = &c.scopes[c.scopeIndex]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+	return l, err
+}
+
+func (c *Compiler) compileLoopJump(isBreak bool) error {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		return fmt.Errorf("break or continue outside of a loop")
+	}
+	l := loops[len(loops)-1]
+
+	if err := c.leaveTryBlocks(l.tries); err != nil {
+		return err
+	}
+	jump := c.emit(code.OpJump, 9999)
+	if isBreak {
+		l.breaks = append(l.breaks, jump)
+	} else {
+		l.continues = append(l.continues, jump)
+	}
+	return nil
+}
+
+func (c *Compiler) patchJumps(jumps []int, target int) {
+	for _, jump := range jumps {
+		c.changeOperand(jump, target)
+	}
+}
+
+func (c *Compiler) compileLetStatement(node *ast.LetStatement) error {
+	if node.Pattern != nil {
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		return c.destructure(node.Pattern)
+	}
+
+	// A function can refer to the name it is bound to, so the name is
+	// defined first. Other values may still refer to an outer variable
+	// of the same name.
+	if _, ok := node.Value.(*ast.FunctionLiteral); ok {
+		c.symbolTable.Define(node.Name.Value)
+	}
+	if err := c.Compile(node.Value); err != nil {
+		return err
+	}
+	c.setSymbol(c.symbolTable.Define(node.Name.Value))
+	return nil
+}
+
+// destructure emits code that binds the names in pattern to the parts of
+// the value on top of the stack.
+func (c *Compiler) destructure(pattern ast.Expression) error {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		c.setSymbol(c.symbolTable.Define(pattern.Value))
+	case *ast.ArrayPattern:
+		rest := 0
+		if pattern.Rest != nil {
+			rest = 1
+		}
+		source := c.addConstant(&object.String{Value: pattern.String()})
+		c.emit(code.OpDestructureArray, len(pattern.Elements), rest, source)
+		for _, element := range pattern.Elements {
+			if err := c.destructure(element); err != nil {
+				return err
+			}
+		}
+		if pattern.Rest != nil {
+			return c.destructure(pattern.Rest)
+		}
+	case *ast.HashPattern:
+		keys := make([]object.Object, len(pattern.Keys))
+		for i, key := range pattern.Keys {
+			keys[i] = &object.String{Value: key.Value}
+		}
+		keysIndex := c.addConstant(&object.Array{Elements: keys})
+		source := c.addConstant(&object.String{Value: pattern.String()})
+		c.emit(code.OpDestructureHash, keysIndex, source)
+		for _, key := range pattern.Keys {
+			if err := c.destructure(key); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("invalid pattern %s", pattern.String())
+	}
+	return nil
+}
+
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral) error {
+	c.enterScope()
+
+	numDefaults := 0
+	for _, p := range node.Parameters {
+		if p.Pattern != nil {
+			c.symbolTable.DefineHidden()
+		} else {
+			c.symbolTable.Define(p.Name.Value)
+		}
+		if p.Default != nil {
+			numDefaults++
+		}
+	}
+	if node.Rest != nil {
+		c.symbolTable.Define(node.Rest.Value)
+	}
+
+	for i, p := range node.Parameters {
+		if p.Default != nil {
+			jumpIfArg := c.emit(code.OpJumpIfArg, i, 9999)
+			if err := c.Compile(p.Default); err != nil {
+				return err
+			}
+			c.emit(code.OpSetLocal, i)
+			c.replaceInstruction(jumpIfArg, c.makeInstruction(code.OpJumpIfArg, i, len(c.currentInstructions())))
+		}
+		if p.Pattern != nil {
+			// Errors binding arguments are reported at the call site.
+			pos := c.pos
+			c.pos = token.Position{}
+			c.emit(code.OpGetLocal, i)
+			if err := c.destructure(p.Pattern); err != nil {
+				return err
+			}
+			c.pos = pos
+		}
+	}
+	prologue := len(c.currentInstructions())
+
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+	c.emit(code.OpReturnValue)
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	fn := &object.CompiledFunction{
+		NumLocals:     c.symbolTable.NumLocals(),
+		NumParameters: len(node.Parameters),
+		NumDefaults:   numDefaults,
+		HasRest:       node.Rest != nil,
+		Name:          node.Name,
+		Prologue:      prologue,
+		LocalNames:    c.symbolTable.LocalNames(),
+	}
+	for _, s := range freeSymbols {
+		fn.FreeNames = append(fn.FreeNames, s.Name)
+	}
+	fn.Instructions, fn.Positions = c.leaveScope()
+
+	for _, s := range freeSymbols {
+		if s.Scope == LocalScope {
+			c.emit(code.OpCaptureLocal, s.Index)
+		} else {
+			c.emit(code.OpCaptureFree, s.Index)
+		}
+	}
+	c.emit(code.OpClosure, c.addConstant(fn), len(freeSymbols))
+	return nil
+}
+
+func (c *Compiler) compileCallExpression(node *ast.CallExpression) error {
+	// quote is an ordinary function once the program binds the name.
+	if identifier, ok := node.Function.(*ast.Identifier); ok && identifier.Value == "quote" {
+		if _, bound := c.symbolTable.Resolve("quote"); !bound {
+			return fmt.Errorf("quote is not supported by the vm engine")
+		}
+	}
+	if err := c.Compile(node.Function); err != nil {
+		return err
+	}
+
+	if !hasSpread(node.Arguments) {
+		for _, a := range node.Arguments {
+			if err := c.Compile(a); err != nil {
+				return err
+			}
+		}
+		if len(node.Arguments) > 255 {
+			return fmt.Errorf("too many arguments: %d", len(node.Arguments))
+		}
+		if node.Tail {
+			c.emit(code.OpTailCall, len(node.Arguments))
+		} else {
+			c.emit(code.OpCall, len(node.Arguments))
+		}
+		return nil
+	}
+
+	if err := c.compileElements(node.Arguments); err != nil {
+		return err
+	}
+	tail := 0
+	if node.Tail {
+		tail = 1
+	}
+	c.emit(code.OpCallSpread, tail)
+	return nil
+}
+
+// compileElements emits code that pushes an array of the values of
+// expressions, some of which may be spread.
+func (c *Compiler) compileElements(expressions []ast.Expression) error {
+	if !hasSpread(expressions) {
+		for _, e := range expressions {
+			if err := c.Compile(e); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(expressions))
+		return nil
+	}
+
+	c.emit(code.OpArray, 0)
+	for _, e := range expressions {
+		if spread, ok := e.(*ast.SpreadExpression); ok {
+			if err := c.Compile(spread.Value); err != nil {
+				return err
+			}
+			c.emit(code.OpSpreadAppend)
+			continue
+		}
+		if err := c.Compile(e); err != nil {
+			return err
+		}
+		c.emit(code.OpAppend)
+	}
+	return nil
+}
+
+func hasSpread(expressions []ast.Expression) bool {
+	for _, e := range expressions {
+		if _, ok := e.(*ast.SpreadExpression); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	}
+}
+
+// setSymbol emits code that binds s, which was just defined, to the value
+// on top of the stack.
+func (c *Compiler) setSymbol(s Symbol) {
+	if s.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, s.Index)
+	} else {
+		c.emit(code.OpSetLocal, s.Index)
+	}
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	ins := c.makeInstruction(op, operands...)
+	return c.addInstruction(ins)
+}
+
+// makeInstruction is code.Make, but remembers the first operand that is
+// out of range so that Compile fails instead of truncating it.
+func (c *Compiler) makeInstruction(op code.Opcode, operands ...int) []byte {
+	if err := code.CheckOperands(op, operands...); err != nil && c.err == nil {
+		c.err = fmt.Errorf("program too large: %w", err)
+	}
+	return code.Make(op, operands...)
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	scope := &c.scopes[c.scopeIndex]
+	posNewInstruction := len(scope.instructions)
+	scope.instructions = append(scope.instructions, ins...)
+
+	if n := len(scope.positions); n == 0 || scope.positions[n-1].Pos != c.pos {
+		scope.positions = append(scope.positions, code.LineEntry{Offset: posNewInstruction, Pos: c.pos})
+	}
+	return posNewInstruction
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	newInstruction := c.makeInstruction(op, operand)
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{})
+	c.scopeIndex++
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() (code.Instructions, code.LineTable) {
+	scope := c.scopes[c.scopeIndex]
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+	c.symbolTable = c.symbolTable.Outer
+	return scope.instructions, scope.positions
+}
+
+// closeUpvalues emits code that closes the variables captured from the
+// local slots allocated since first, which belong to a block scope that is
+// being left. Slots allocated later by the enclosing scopes are not
+// touched.
+func (c *Compiler) closeUpvalues(first int) {
+	c.emit(code.OpCloseUpvalues, first, c.symbolTable.NumLocals()-first)
+}
+
+func (c *Compiler) enterBlockScope() {
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveBlockScope() {
+	c.symbolTable = c.symbolTable.Outer
+}
@@ -0,0 +1,542 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"monkey/code"
+	"monkey/object"
+	"monkey/token"
+)
+
+// A compiled program file starts with Magic, followed by the format
+// version as a big-endian uint16 and a flags byte. The rest is a sequence
+// of unsigned varints, strings prefixed with their length, and
+// constants tagged with their type:
+//
+//	globals    count, name...
+//	constants  count, constant...
+//	main       function
+//
+// A function holds its name, its counts of locals, parameters and
+// defaults, whether it has a rest parameter, its prologue offset, the
+// names of its locals and free variables, its instructions and, when
+// FlagLineTable is set, its line table.
+const Magic = "MKC\x00"
+
+// FormatVersion is the version of the compiled program format written by
+// WriteBytecode. It changes whenever the format or the meaning of the
+// instructions changes; ReadBytecode accepts no other version.
+const FormatVersion = 2
+
+const (
+	// FlagLineTable is set when the functions carry their line tables,
+	// which map instructions back to source positions in error messages.
+	FlagLineTable = 1 << iota
+)
+
+const (
+	tagInteger  = 'i'
+	tagFloat    = 'f'
+	tagString   = 's'
+	tagArray    = 'a'
+	tagFunction = 'F'
+)
+
+var ErrNotBytecode = errors.New("not a compiled Monkey program")
+
+// VersionError reports a compiled program written in an unsupported
+// version of the format.
+type VersionError struct {
+	Version int
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("compiled program has format version %d, want %d; compile it again", e.Version, FormatVersion)
+}
+
+// IsBytecode reports whether data starts like a compiled program.
+func IsBytecode(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(Magic))
+}
+
+// WriteBytecode writes bytecode to w. Without lineTable, errors raised by
+// the program report no source positions.
+func WriteBytecode(w io.Writer, bytecode *Bytecode, lineTable bool) error {
+	e := &encoder{lineTable: lineTable}
+	e.buf.WriteString(Magic)
+	binary.Write(&e.buf, binary.BigEndian, uint16(FormatVersion))
+	var flags byte
+	if lineTable {
+		flags |= FlagLineTable
+	}
+	e.buf.WriteByte(flags)
+
+	e.writeStrings(bytecode.Globals)
+	e.writeUint(len(bytecode.Constants))
+	for _, constant := range bytecode.Constants {
+		if err := e.writeConstant(constant); err != nil {
+			return err
+		}
+	}
+	e.writeFunction(bytecode.Main)
+
+	_, err := w.Write(e.buf.Bytes())
+	return err
+}
+
+// ReadBytecode reads a compiled program written by WriteBytecode.
+func ReadBytecode(r io.Reader) (*Bytecode, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if !IsBytecode(data) || len(data) < len(Magic)+3 {
+		return nil, ErrNotBytecode
+	}
+	data = data[len(Magic):]
+	if version := int(binary.BigEndian.Uint16(data)); version != FormatVersion {
+		return nil, &VersionError{Version: version}
+	}
+
+	d := &decoder{data: data[3:], lineTable: data[2]&FlagLineTable != 0}
+	bytecode := &Bytecode{Globals: d.readStrings()}
+	if n := d.readUint(); n > 0 && d.err == nil {
+		bytecode.Constants = make([]object.Object, 0, min(n, len(d.data)))
+		for i := 0; i < n && d.err == nil; i++ {
+			bytecode.Constants = append(bytecode.Constants, d.readConstant())
+		}
+	}
+	bytecode.Main = d.readFunction()
+
+	if d.err == nil && len(d.data) > 0 {
+		d.fail("%d bytes of trailing data", len(d.data))
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if err := validate(bytecode); err != nil {
+		return nil, err
+	}
+	return bytecode, nil
+}
+
+type encoder struct {
+	buf       bytes.Buffer
+	lineTable bool
+}
+
+func (e *encoder) writeUint(n int) {
+	e.buf.Write(binary.AppendUvarint(nil, uint64(n)))
+}
+
+func (e *encoder) writeString(s string) {
+	e.writeUint(len(s))
+	e.buf.WriteString(s)
+}
+
+func (e *encoder) writeStrings(strings []string) {
+	e.writeUint(len(strings))
+	for _, s := range strings {
+		e.writeString(s)
+	}
+}
+
+func (e *encoder) writeConstant(constant object.Object) error {
+	switch constant := constant.(type) {
+	case *object.Integer:
+		e.buf.WriteByte(tagInteger)
+		e.buf.Write(binary.AppendVarint(nil, constant.Value))
+	case *object.Float:
+		e.buf.WriteByte(tagFloat)
+		binary.Write(&e.buf, binary.BigEndian, math.Float64bits(constant.Value))
+	case *object.String:
+		e.buf.WriteByte(tagString)
+		e.writeString(constant.Value)
+	case *object.Array:
+		e.buf.WriteByte(tagArray)
+		e.writeUint(len(constant.Elements))
+		for _, element := range constant.Elements {
+			if err := e.writeConstant(element); err != nil {
+				return err
+			}
+		}
+	case *object.CompiledFunction:
+		e.buf.WriteByte(tagFunction)
+		e.writeFunction(constant)
+	default:
+		return fmt.Errorf("cannot write constant of type %s", constant.Type())
+	}
+	return nil
+}
+
+func (e *encoder) writeFunction(fn *object.CompiledFunction) {
+	e.writeString(fn.Name)
+	e.writeUint(fn.NumLocals)
+	e.writeUint(fn.NumParameters)
+	e.writeUint(fn.NumDefaults)
+	if fn.HasRest {
+		e.writeUint(1)
+	} else {
+		e.writeUint(0)
+	}
+	e.writeUint(fn.Prologue)
+	e.writeStrings(fn.LocalNames)
+	e.writeStrings(fn.FreeNames)
+	e.writeUint(len(fn.Instructions))
+	e.buf.Write(fn.Instructions)
+
+	if e.lineTable {
+		e.writeUint(len(fn.Positions))
+		for _, entry := range fn.Positions {
+			e.writeUint(entry.Offset)
+			e.writeUint(entry.Pos.Offset)
+			e.writeUint(entry.Pos.Line)
+			e.writeUint(entry.Pos.Column)
+		}
+	}
+}
+
+// decoder reads the parts of a compiled program. After the first error
+// it reads only zero values and keeps the error in err.
+type decoder struct {
+	data      []byte
+	lineTable bool
+	err       error
+}
+
+func (d *decoder) fail(format string, a ...any) {
+	if d.err == nil {
+		d.err = fmt.Errorf("malformed compiled program: "+format, a...)
+	}
+	d.data = nil
+}
+
+func (d *decoder) readUint() int {
+	n, size := binary.Uvarint(d.data)
+	if size == 0 {
+		d.fail("unexpected end of data")
+		return 0
+	}
+	if size < 0 || n > math.MaxInt32 {
+		d.fail("bad number")
+		return 0
+	}
+	d.data = d.data[size:]
+	return int(n)
+}
+
+func (d *decoder) readBytes(n int) []byte {
+	if n > len(d.data) {
+		d.fail("unexpected end of data")
+		return nil
+	}
+	b := d.data[:n:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *decoder) readString() string {
+	return string(d.readBytes(d.readUint()))
+}
+
+func (d *decoder) readStrings() []string {
+	n := d.readUint()
+	if n > len(d.data) {
+		d.fail("too many strings")
+		return nil
+	}
+	var strings []string
+	for i := 0; i < n; i++ {
+		strings = append(strings, d.readString())
+	}
+	return strings
+}
+
+func (d *decoder) readConstant() object.Object {
+	tag := d.readBytes(1)
+	if tag == nil {
+		return nil
+	}
+
+	switch tag[0] {
+	case tagInteger:
+		n, size := binary.Varint(d.data)
+		if size == 0 {
+			d.fail("unexpected end of data")
+			return nil
+		}
+		if size < 0 {
+			d.fail("bad integer")
+			return nil
+		}
+		d.data = d.data[size:]
+		return &object.Integer{Value: n}
+	case tagFloat:
+		bits := d.readBytes(8)
+		if bits == nil {
+			return nil
+		}
+		return &object.Float{Value: math.Float64frombits(binary.BigEndian.Uint64(bits))}
+	case tagString:
+		return &object.String{Value: d.readString()}
+	case tagArray:
+		n := d.readUint()
+		if n > len(d.data) {
+			d.fail("too many elements")
+			return nil
+		}
+		elements := []object.Object{}
+		for i := 0; i < n && d.err == nil; i++ {
+			elements = append(elements, d.readConstant())
+		}
+		return &object.Array{Elements: elements}
+	case tagFunction:
+		return d.readFunction()
+	default:
+		d.fail("unknown constant tag %q", tag[0])
+		return nil
+	}
+}
+
+func (d *decoder) readFunction() *object.CompiledFunction {
+	fn := &object.CompiledFunction{
+		Name:          d.readString(),
+		NumLocals:     d.readUint(),
+		NumParameters: d.readUint(),
+		NumDefaults:   d.readUint(),
+		HasRest:       d.readUint() == 1,
+		Prologue:      d.readUint(),
+		LocalNames:    d.readStrings(),
+		FreeNames:     d.readStrings(),
+	}
+	if n := d.readUint(); n > 0 {
+		fn.Instructions = code.Instructions(d.readBytes(n))
+	}
+
+	if d.lineTable {
+		n := d.readUint()
+		if n > len(d.data) {
+			d.fail("too many line entries")
+			return fn
+		}
+		for i := 0; i < n; i++ {
+			entry := code.LineEntry{Offset: d.readUint()}
+			entry.Pos = token.Position{Offset: d.readUint(), Line: d.readUint(), Column: d.readUint()}
+			fn.Positions = append(fn.Positions, entry)
+		}
+	}
+	return fn
+}
+
+// validate checks that the instructions of a program read from a file
+// only refer to constants, locals and jump targets that exist and never
+// pop more values than they pushed, so that a damaged file is reported
+// instead of being run. The kinds of the values instructions use are
+// checked by the VM, which stops with an error on a mismatch.
+func validate(bytecode *Bytecode) error {
+	functions := []*object.CompiledFunction{bytecode.Main}
+	for _, constant := range bytecode.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			functions = append(functions, fn)
+		}
+	}
+
+	for _, fn := range functions {
+		if err := validateFunction(fn, bytecode); err != nil {
+			name := fn.Name
+			if name == "" {
+				name = "anonymous function"
+			}
+			return fmt.Errorf("malformed compiled program: %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func validateFunction(fn *object.CompiledFunction, bytecode *Bytecode) error {
+	if len(fn.LocalNames) != fn.NumLocals || fn.NumLocals < fn.NumParameters || len(fn.Instructions) == 0 {
+		return fmt.Errorf("inconsistent function header")
+	}
+
+	ins := fn.Instructions
+	starts := make(map[int]bool)
+	var jumps []int
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			return err
+		}
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if i+1+width > len(ins) {
+			return fmt.Errorf("truncated %s at %d", def.Name, i)
+		}
+		operands, _ := code.ReadOperands(def, ins[i+1:])
+
+		var bad bool
+		switch op := code.Opcode(ins[i]); op {
+		case code.OpConstant:
+			bad = operands[0] >= len(bytecode.Constants)
+		case code.OpClosure:
+			bad = operands[0] >= len(bytecode.Constants)
+			if !bad {
+				_, isFunction := bytecode.Constants[operands[0]].(*object.CompiledFunction)
+				bad = !isFunction
+			}
+		case code.OpGetGlobal, code.OpSetGlobal, code.OpAssignGlobal:
+			bad = operands[0] >= len(bytecode.Globals)
+		case code.OpGetLocal, code.OpSetLocal, code.OpCaptureLocal:
+			bad = operands[0] >= fn.NumLocals
+		case code.OpCloseUpvalues:
+			bad = operands[0]+operands[1] > fn.NumLocals
+		case code.OpGetFree, code.OpSetFree, code.OpCaptureFree:
+			bad = operands[0] >= len(fn.FreeNames)
+		case code.OpGetBuiltin:
+			bad = operands[0] >= len(object.Builtins)
+		case code.OpDestructureArray:
+			bad = !isConstant[*object.String](bytecode, operands[2])
+		case code.OpDestructureHash:
+			bad = !isConstant[*object.Array](bytecode, operands[0]) || !isConstant[*object.String](bytecode, operands[1])
+			if !bad {
+				for _, key := range bytecode.Constants[operands[0]].(*object.Array).Elements {
+					if _, ok := key.(*object.String); !ok {
+						bad = true
+					}
+				}
+			}
+		case code.OpJump, code.OpJumpNotTruthy, code.OpIterNext, code.OpTry:
+			jumps = append(jumps, operands[0])
+		case code.OpJumpIfArg:
+			jumps = append(jumps, operands[1])
+		}
+		if bad {
+			return fmt.Errorf("bad operand for %s at %d", def.Name, i)
+		}
+
+		starts[i] = true
+		i += 1 + width
+	}
+
+	for _, target := range jumps {
+		if !starts[target] {
+			return fmt.Errorf("jump to %d", target)
+		}
+	}
+	return checkStack(fn, bytecode)
+}
+
+// checkStack follows every path through the instructions of fn, which
+// validateFunction has decoded successfully, and reports an instruction
+// that could pop more values than the function has pushed, or a path that
+// runs past the last instruction. Paths may join with different depths,
+// as after a break out of an expression, so the lowest is kept.
+func checkStack(fn *object.CompiledFunction, bytecode *Bytecode) error {
+	ins := fn.Instructions
+	depths := map[int]int{0: 0}
+	pending := []int{0}
+	visit := func(ip, depth int) {
+		if seen, ok := depths[ip]; !ok || depth < seen {
+			depths[ip] = depth
+			pending = append(pending, ip)
+		}
+	}
+
+	for len(pending) > 0 {
+		ip := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if ip >= len(ins) {
+			return fmt.Errorf("missing return at %d", ip)
+		}
+
+		op := code.Opcode(ins[ip])
+		def, _ := code.Lookup(ins[ip])
+		operands, width := code.ReadOperands(def, ins[ip+1:])
+		pop, push := stackEffect(op, operands, bytecode)
+		depth := depths[ip]
+		if pop > depth {
+			return fmt.Errorf("stack underflow in %s at %d", def.Name, ip)
+		}
+		depth += push - pop
+
+		next := ip + 1 + width
+		switch op {
+		case code.OpReturnValue, code.OpThrow:
+		case code.OpJump:
+			visit(operands[0], depth)
+		case code.OpJumpNotTruthy:
+			visit(operands[0], depth)
+			visit(next, depth)
+		case code.OpJumpIfArg:
+			visit(operands[1], depth)
+			visit(next, depth)
+		case code.OpIterNext:
+			// The exhausted iterator is popped without pushing an item.
+			visit(operands[0], depth-1)
+			visit(next, depth)
+		case code.OpTry:
+			// The handler resets the stack and pushes the error.
+			visit(operands[0], depth+1)
+			visit(next, depth)
+		default:
+			visit(next, depth)
+		}
+	}
+	return nil
+}
+
+// stackEffect returns how many values an instruction pops and then pushes
+// when execution continues with the next instruction.
+func stackEffect(op code.Opcode, operands []int, bytecode *Bytecode) (pop, push int) {
+	switch op {
+	case code.OpConstant, code.OpTrue, code.OpFalse, code.OpNull,
+		code.OpGetGlobal, code.OpGetLocal, code.OpGetFree, code.OpGetBuiltin,
+		code.OpCaptureLocal, code.OpCaptureFree:
+		return 0, 1
+	case code.OpPop, code.OpSetGlobal, code.OpAssignGlobal, code.OpSetLocal, code.OpSetFree,
+		code.OpReturnValue, code.OpThrow:
+		return 1, 0
+	case code.OpDup:
+		return 1, 2
+	case code.OpSwap:
+		return 2, 2
+	case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+		code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan,
+		code.OpGreaterEqual, code.OpLessEqual,
+		code.OpAppend, code.OpSpreadAppend, code.OpIndex, code.OpMatchEqual, code.OpCallSpread:
+		return 2, 1
+	case code.OpMinus, code.OpBang, code.OpBool, code.OpIterInit, code.OpIterNext,
+		code.OpMatchLength, code.OpCatch:
+		return 1, 1
+	case code.OpJumpNotTruthy:
+		return 1, 0
+	case code.OpArray, code.OpHash, code.OpClosure:
+		n := operands[0]
+		if op == code.OpClosure {
+			n = operands[1]
+		}
+		return n, 1
+	case code.OpSetIndex:
+		return 3, 1
+	case code.OpCall, code.OpTailCall:
+		return operands[0] + 1, 1
+	case code.OpDestructureArray:
+		return 1, operands[0] + operands[1]
+	case code.OpDestructureHash:
+		return 1, len(bytecode.Constants[operands[0]].(*object.Array).Elements)
+	}
+	return 0, 0
+}
+
+func isConstant[T object.Object](bytecode *Bytecode, index int) bool {
+	if index >= len(bytecode.Constants) {
+		return false
+	}
+	_, ok := bytecode.Constants[index].(T)
+	return ok
+}
@@ -0,0 +1,145 @@
+package compiler
+
+import (
+	"bytes"
+	"errors"
+	"monkey/code"
+	"monkey/object"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const serializeInput = `
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+let f = fn(x, y = 2.5, ...rest) { [x, y, rest, "text"] };
+let counter = fn() { let n = 0; fn() { n = n + 1 } };
+let {a, b} = {"a": 1, "b": 2};
+let [c, ...d] = [1, 2, 3];
+for (x in [1, 2]) { try { throw(x) } catch (e) { e } finally { puts(x) } }
+match (c) { [1, y] => y, _ => -1 }
+`
+
+func compileForTest(t *testing.T, input string) *Bytecode {
+	t.Helper()
+
+	compiler := New()
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return compiler.Bytecode()
+}
+
+func writeForTest(t *testing.T, bytecode *Bytecode, lineTable bool) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := WriteBytecode(&buf, bytecode, lineTable); err != nil {
+		t.Fatalf("WriteBytecode: %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestBytecodeRoundTrip(t *testing.T) {
+	bytecode := compileForTest(t, serializeInput)
+
+	data := writeForTest(t, bytecode, true)
+	if !IsBytecode(data) {
+		t.Fatalf("written data does not start with the magic header")
+	}
+	read, err := ReadBytecode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadBytecode: %s", err)
+	}
+	if !reflect.DeepEqual(read, bytecode) {
+		t.Errorf("bytecode changed in round trip.\nwant=%s\ngot=%s",
+			bytecode.Main.Instructions, read.Main.Instructions)
+	}
+}
+
+func TestBytecodeWithoutLineTable(t *testing.T) {
+	bytecode := compileForTest(t, serializeInput)
+
+	read, err := ReadBytecode(bytes.NewReader(writeForTest(t, bytecode, false)))
+	if err != nil {
+		t.Fatalf("ReadBytecode: %s", err)
+	}
+	if read.Main.Positions != nil {
+		t.Errorf("main function has a line table: %v", read.Main.Positions)
+	}
+	for i, constant := range read.Constants {
+		fn, ok := constant.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+		if fn.Positions != nil {
+			t.Errorf("constant %d has a line table: %v", i, fn.Positions)
+		}
+		want := bytecode.Constants[i].(*object.CompiledFunction)
+		if !bytes.Equal(fn.Instructions, want.Instructions) {
+			t.Errorf("constant %d has wrong instructions.\nwant=%s\ngot=%s",
+				i, want.Instructions, fn.Instructions)
+		}
+	}
+}
+
+func TestReadBytecodeErrors(t *testing.T) {
+	valid := writeForTest(t, compileForTest(t, serializeInput), true)
+
+	newVersion := bytes.Clone(valid)
+	newVersion[len(Magic)+1] = FormatVersion + 1
+
+	badConstant := compileForTest(t, `1`)
+	badConstant.Main.Instructions = code.Make(code.OpConstant, 5)
+	badJump := compileForTest(t, `1`)
+	badJump.Main.Instructions = append(code.Make(code.OpJump, 1), badJump.Main.Instructions...)
+	underflow := compileForTest(t, `1`)
+	underflow.Main.Instructions = concatInstructions([]code.Instructions{
+		code.Make(code.OpPop), code.Make(code.OpPop), code.Make(code.OpPop), code.Make(code.OpReturnValue),
+	})
+	noReturn := compileForTest(t, `1`)
+	noReturn.Main.Instructions = code.Make(code.OpTrue)
+	badKeys := compileForTest(t, `let {a} = {"a": 1}; a`)
+	for _, constant := range badKeys.Constants {
+		if keys, ok := constant.(*object.Array); ok {
+			keys.Elements[0] = &object.Integer{Value: 1}
+		}
+	}
+
+	tests := []struct {
+		data     []byte
+		expected string
+	}{
+		{[]byte("let x = 1;"), "not a compiled Monkey program"},
+		{[]byte(Magic), "not a compiled Monkey program"},
+		{newVersion, "compiled program has format version 3, want 2; compile it again"},
+		{valid[:len(valid)-3], "malformed compiled program: unexpected end of data"},
+		{append(bytes.Clone(valid), 0), "malformed compiled program: 1 bytes of trailing data"},
+		{writeForTest(t, badConstant, true), "malformed compiled program: anonymous function: bad operand for OpConstant at 0"},
+		{writeForTest(t, badJump, true), "malformed compiled program: anonymous function: jump to 1"},
+		{writeForTest(t, underflow, true), "malformed compiled program: anonymous function: stack underflow in OpPop at 0"},
+		{writeForTest(t, noReturn, true), "malformed compiled program: anonymous function: missing return at 1"},
+		{writeForTest(t, badKeys, true), "malformed compiled program: anonymous function: bad operand for OpDestructureHash at 9"},
+	}
+
+	for _, tt := range tests {
+		_, err := ReadBytecode(bytes.NewReader(tt.data))
+		if err == nil {
+			t.Errorf("expected error %q, got none", tt.expected)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, err)
+		}
+	}
+
+	_, err := ReadBytecode(bytes.NewReader(newVersion))
+	var versionErr *VersionError
+	if !errors.As(err, &versionErr) || versionErr.Version != FormatVersion+1 {
+		t.Errorf("expected a *VersionError for version %d, got %v", FormatVersion+1, err)
+	}
+	_, err = ReadBytecode(strings.NewReader("MKD\x00\x00\x01\x00"))
+	if err != ErrNotBytecode {
+		t.Errorf("expected ErrNotBytecode, got %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package compiler
+
+type SymbolScope string
+
+const (
+	GlobalScope  SymbolScope = "GLOBAL"
+	LocalScope   SymbolScope = "LOCAL"
+	BuiltinScope SymbolScope = "BUILTIN"
+	FreeScope    SymbolScope = "FREE"
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+// SymbolTable maps names to the slots that hold them. There is one table
+// for the globals, one per function and one per block that opens a new
+// scope, like the body of a for loop. Block tables allocate their locals
+// in the slots of the enclosing function, or of the main program for
+// blocks outside any function.
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store       map[string]Symbol
+	FreeSymbols []Symbol
+
+	globalNames []string
+	localNames  []string
+
+	// function is the table that owns the local slots: the table itself
+	// for functions and the global table, the enclosing one for blocks.
+	function *SymbolTable
+}
+
+func NewSymbolTable() *SymbolTable {
+	s := &SymbolTable{store: make(map[string]Symbol)}
+	s.function = s
+	return s
+}
+
+// NewEnclosedSymbolTable returns the table of a function nested in outer.
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// NewBlockSymbolTable returns the table of a block scope nested in outer.
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	s.function = outer.function
+	return s
+}
+
+func (s *SymbolTable) isGlobal() bool {
+	return s.Outer == nil
+}
+
+func (s *SymbolTable) isBlock() bool {
+	return s.function != s
+}
+
+// NumLocals returns how many local slots the function owning s uses.
+func (s *SymbolTable) NumLocals() int {
+	return len(s.function.localNames)
+}
+
+// LocalNames returns the names of the local slots of the function owning s.
+func (s *SymbolTable) LocalNames() []string {
+	return s.function.localNames
+}
+
+// GlobalNames returns the names of the global slots.
+func (s *SymbolTable) GlobalNames() []string {
+	return s.global().globalNames
+}
+
+func (s *SymbolTable) global() *SymbolTable {
+	for s.Outer != nil {
+		s = s.Outer
+	}
+	return s
+}
+
+// Define binds name in s. Defining a name again in the same table reuses
+// its slot, like assigning it.
+func (s *SymbolTable) Define(name string) Symbol {
+	if symbol, ok := s.store[name]; ok && (symbol.Scope == GlobalScope || symbol.Scope == LocalScope) {
+		return symbol
+	}
+
+	var symbol Symbol
+	if s.isGlobal() {
+		symbol = Symbol{Name: name, Scope: GlobalScope, Index: s.defineGlobalSlot(name)}
+	} else {
+		symbol = Symbol{Name: name, Scope: LocalScope, Index: s.defineSlot(name)}
+	}
+	s.store[name] = symbol
+	return symbol
+}
+
+// DefineHidden allocates a local slot that no name refers to, for values
+// the compiler keeps around, such as the iterator of a loop.
+func (s *SymbolTable) DefineHidden() Symbol {
+	return Symbol{Scope: LocalScope, Index: s.defineSlot("")}
+}
+
+// DefineUnbound allocates a global slot for name that the name does not
+// resolve to, so it stays undefined. Assigning to a builtin uses it.
+func (s *SymbolTable) DefineUnbound(name string) Symbol {
+	return Symbol{Name: name, Scope: GlobalScope, Index: s.global().defineGlobalSlot(name)}
+}
+
+func (s *SymbolTable) defineGlobalSlot(name string) int {
+	s.globalNames = append(s.globalNames, name)
+	return len(s.globalNames) - 1
+}
+
+func (s *SymbolTable) defineSlot(name string) int {
+	owner := s.function
+	owner.localNames = append(owner.localNames, name)
+	return len(owner.localNames) - 1
+}
+
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Scope: BuiltinScope, Index: index}
+	s.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Scope: FreeScope, Index: len(s.FreeSymbols) - 1}
+	s.store[original.Name] = symbol
+	return symbol
+}
+
+// Resolve looks name up in s and its enclosing tables. Locals of enclosing
+// functions become free symbols of every function in between.
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if ok || s.Outer == nil {
+		return symbol, ok
+	}
+
+	symbol, ok = s.Outer.Resolve(name)
+	if !ok || s.isBlock() || symbol.Scope == GlobalScope || symbol.Scope == BuiltinScope {
+		return symbol, ok
+	}
+	return s.defineFree(symbol), true
+}
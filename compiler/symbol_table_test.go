@@ -0,0 +1,109 @@
+package compiler
+
+import "testing"
+
+func TestDefine(t *testing.T) {
+	global := NewSymbolTable()
+	a := global.Define("a")
+	b := global.Define("b")
+	if a != (Symbol{Name: "a", Scope: GlobalScope, Index: 0}) {
+		t.Errorf("a wrong. got=%+v", a)
+	}
+	if b != (Symbol{Name: "b", Scope: GlobalScope, Index: 1}) {
+		t.Errorf("b wrong. got=%+v", b)
+	}
+	if again := global.Define("a"); again != a {
+		t.Errorf("redefining a did not reuse its slot. got=%+v", again)
+	}
+
+	local := NewEnclosedSymbolTable(global)
+	c := local.Define("c")
+	if c != (Symbol{Name: "c", Scope: LocalScope, Index: 0}) {
+		t.Errorf("c wrong. got=%+v", c)
+	}
+
+	block := NewBlockSymbolTable(local)
+	d := block.Define("d")
+	if d != (Symbol{Name: "d", Scope: LocalScope, Index: 1}) {
+		t.Errorf("d wrong. got=%+v", d)
+	}
+	hidden := block.DefineHidden()
+	if hidden.Index != 2 {
+		t.Errorf("hidden slot wrong. got=%+v", hidden)
+	}
+	if local.NumLocals() != 3 {
+		t.Errorf("wrong number of locals. want=3, got=%d", local.NumLocals())
+	}
+
+	mainBlock := NewBlockSymbolTable(global)
+	e := mainBlock.Define("e")
+	if e != (Symbol{Name: "e", Scope: LocalScope, Index: 0}) {
+		t.Errorf("e wrong. got=%+v", e)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	global.DefineBuiltin(0, "len")
+
+	first := NewEnclosedSymbolTable(global)
+	first.Define("b")
+	block := NewBlockSymbolTable(first)
+	block.Define("c")
+
+	second := NewEnclosedSymbolTable(block)
+	second.Define("d")
+
+	tests := []struct {
+		table    *SymbolTable
+		name     string
+		expected Symbol
+	}{
+		{second, "a", Symbol{Name: "a", Scope: GlobalScope, Index: 0}},
+		{second, "len", Symbol{Name: "len", Scope: BuiltinScope, Index: 0}},
+		{second, "d", Symbol{Name: "d", Scope: LocalScope, Index: 0}},
+		{second, "c", Symbol{Name: "c", Scope: FreeScope, Index: 0}},
+		{second, "b", Symbol{Name: "b", Scope: FreeScope, Index: 1}},
+		{block, "b", Symbol{Name: "b", Scope: LocalScope, Index: 0}},
+		{block, "c", Symbol{Name: "c", Scope: LocalScope, Index: 1}},
+	}
+
+	for _, tt := range tests {
+		result, ok := tt.table.Resolve(tt.name)
+		if !ok {
+			t.Errorf("name %s not resolvable", tt.name)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", tt.name, tt.expected, result)
+		}
+	}
+
+	expectedFree := []Symbol{
+		{Name: "c", Scope: LocalScope, Index: 1},
+		{Name: "b", Scope: LocalScope, Index: 0},
+	}
+	if len(second.FreeSymbols) != len(expectedFree) {
+		t.Fatalf("wrong number of free symbols. got=%d", len(second.FreeSymbols))
+	}
+	for i, sym := range expectedFree {
+		if second.FreeSymbols[i] != sym {
+			t.Errorf("wrong free symbol. want=%+v, got=%+v", sym, second.FreeSymbols[i])
+		}
+	}
+
+	if _, ok := second.Resolve("missing"); ok {
+		t.Errorf("missing resolved")
+	}
+}
+
+func TestDefineShadowsBuiltin(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineBuiltin(0, "len")
+	global.Define("len")
+
+	if symbol, _ := global.Resolve("len"); symbol.Scope != GlobalScope {
+		t.Errorf("len not shadowed. got=%+v", symbol)
+	}
+}
@@ -0,0 +1,30 @@
+package evaluator
+
+import (
+	"math"
+	"monkey/object"
+)
+
+func overflowError(left int64, operator string, right int64) *object.Error {
+	return newError("integer overflow: %d %s %d", left, operator, right)
+}
+
+func addOverflows(a, b int64) bool {
+	sum := a + b
+	return (a > 0 && b > 0 && sum < 0) || (a < 0 && b < 0 && sum >= 0)
+}
+
+func subOverflows(a, b int64) bool {
+	diff := a - b
+	return (a >= 0 && b < 0 && diff < 0) || (a < 0 && b > 0 && diff >= 0)
+}
+
+func mulOverflows(a, b int64) bool {
+	if a == 0 || b == 0 {
+		return false
+	}
+	if (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return true
+	}
+	return (a*b)/b != a
+}
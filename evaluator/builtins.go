@@ -2,101 +2,14 @@ package evaluator
 
 import "monkey/object"
 
-var builtins = map[string]*object.Builtin{
-	"len": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
-
-			switch arg := args[0].(type) {
-
-			case *object.String:
-				return &object.Integer{Value: int64(len(arg.Value))}
-			case *object.Array:
-				return &object.Integer{Value: int64(len(arg.Elements))}
-			default:
-				return newError("argument to `len` not supported, got %s", args[0].Type())
-			}
-		},
-	},
-	"first": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
-
-			switch arg := args[0].(type) {
-
-			case *object.Array:
-				if len(arg.Elements) > 0 {
-					return arg.Elements[0]
-				} else {
-					return object.NULL
-				}
-			default:
-				return newError("argument to `first` not supported, got %s", args[0].Type())
-			}
-		},
-	},
-	"last": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
-
-			switch arg := args[0].(type) {
-
-			case *object.Array:
-				if len(arg.Elements) > 0 {
-					return arg.Elements[len(arg.Elements)-1]
-				} else {
-					return object.NULL
-				}
-			default:
-				return newError("argument to `last` not supported, got %s", args[0].Type())
-			}
-		},
-	},
-	"rest": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
-
-			switch arg := args[0].(type) {
-
-			case *object.Array:
-				size := len(arg.Elements) - 1
-				if size > 0 {
-					result := make([]object.Object, size)
-					copy(result, arg.Elements[1:size+1])
-					return &object.Array{Elements: result}
-				} else {
-					return object.NULL
-				}
-			default:
-				return newError("argument to `last` not supported, got %s", args[0].Type())
-			}
-		},
-	},
-	"push": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 2 {
-				return newError("wrong number of arguments. got=%d, want=2", len(args))
-			}
-
-			switch arg := args[0].(type) {
-
-			case *object.Array:
-				size := len(arg.Elements)
-				result := make([]object.Object, size+1)
-				copy(result, arg.Elements)
-				result[size] = args[1]
-				return &object.Array{Elements: result}
-			default:
-				return newError("argument to `last` not supported, got %s", args[0].Type())
-			}
-		},
-	},
+// builtin returns the builtin function called name, or nil. The `args`
+// builtin returns the script arguments of this evaluation.
+func (ev *evaluation) builtin(name string) *object.Builtin {
+	if name != "args" {
+		return object.GetBuiltinByName(name)
+	}
+	if ev.args == nil {
+		ev.args = object.ArgsBuiltin(ev.options.Args)
+	}
+	return ev.args
 }
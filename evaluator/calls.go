@@ -0,0 +1,33 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"monkey/token"
+)
+
+// DefaultMaxCallDepth is the call depth limit used unless Options.MaxCallDepth
+// sets another.
+const DefaultMaxCallDepth = 10000
+
+// MaxStackFrames bounds the frames recorded on an error unwinding out of
+// deep recursion; the innermost frames and the outermost one are kept.
+const MaxStackFrames = 100
+
+// tailCall stands in for the result of a call in tail position. It is
+// returned up to the enclosing applyFunction, which makes the call after
+// the caller's body has finished, so tail recursion runs in constant
+// stack. The frames of the eliminated callers do not show up in
+// stack traces.
+type tailCall struct {
+	function object.Object
+	args     []object.Object
+	pos      token.Position
+}
+
+func (tc *tailCall) Type() object.ObjectType {
+	return "TAIL_CALL"
+}
+
+func (tc *tailCall) Inspect() string {
+	return "tail call"
+}
@@ -0,0 +1,78 @@
+package evaluator
+
+import (
+	"context"
+	"monkey/ast"
+	"monkey/object"
+)
+
+const (
+	timeoutMessage        = "evaluation timed out"
+	canceledMessage       = "evaluation canceled"
+	budgetExceededMessage = "step budget exceeded"
+)
+
+// ctxCheckInterval is how many steps pass between two looks at the
+// context, which keeps the check off the hot path of every node.
+const ctxCheckInterval = 1024
+
+// EvalContext evaluates node like Eval, but gives up once ctx is done or,
+// when budget is positive, after budget nodes have been evaluated. A
+// script stopped this way yields an error for which IsTimeout or
+// IsBudgetExceeded reports true; try/catch cannot intercept it.
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment, budget int64) object.Object {
+	return EvalWithOptions(node, env, Options{Context: ctx, Budget: budget})
+}
+
+// IsTimeout reports whether obj is the error returned by EvalContext when
+// its context was canceled or its deadline passed.
+func IsTimeout(obj object.Object) bool {
+	return isRuntimeError(obj, timeoutMessage) || isRuntimeError(obj, canceledMessage)
+}
+
+// IsBudgetExceeded reports whether obj is the error returned by
+// EvalContext when the script ran out of steps.
+func IsBudgetExceeded(obj object.Object) bool {
+	return isRuntimeError(obj, budgetExceededMessage)
+}
+
+func isInterrupt(obj object.Object) bool {
+	return IsTimeout(obj) || IsBudgetExceeded(obj)
+}
+
+// isRuntimeError reports whether obj is an error raised by the evaluator
+// with the given message, as opposed to a value passed to throw.
+func isRuntimeError(obj object.Object, message string) bool {
+	err, ok := obj.(*object.Error)
+	return ok && err.Value == nil && err.Message == message
+}
+
+// checkInterrupt counts one evaluation step and reports an error once the
+// context in its options is done or the step budget is used up.
+func (ev *evaluation) checkInterrupt() *object.Error {
+	if ev.options.Context == nil && ev.options.Budget <= 0 {
+		return nil
+	}
+	if ev.stopped != "" {
+		return newError(ev.stopped)
+	}
+
+	ev.steps++
+	if ev.options.Budget > 0 && ev.steps > ev.options.Budget {
+		ev.stopped = budgetExceededMessage
+	} else if ev.options.Context != nil && ev.steps%ctxCheckInterval == 1 {
+		select {
+		case <-ev.options.Context.Done():
+			ev.stopped = canceledMessage
+			if ev.options.Context.Err() == context.DeadlineExceeded {
+				ev.stopped = timeoutMessage
+			}
+		default:
+		}
+	}
+
+	if ev.stopped != "" {
+		return newError(ev.stopped)
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package evaluator_test
+
+import (
+	"bytes"
+	"fmt"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/vm"
+	"strings"
+	"testing"
+)
+
+// An engine executes Monkey programs. Every engine must give the same
+// results as the evaluator.
+type engine struct {
+	name string
+	run  func(program *ast.Program) object.Object
+}
+
+var engines = []engine{
+	{"vm", runVM},
+	{"vm from file", runVMFromFile},
+}
+
+// extraPrograms add to the programs of the evaluator tests those that check
+// their results with something other than a table.
+var extraPrograms = []string{
+	`"Hello" + " " + "World!"`,
+	"[1, 2 * 2, 3 + 3]",
+	`let two = "two"; {"one": 10 - 9, two: 1 + 1, "thr" + "ee": 6 / 2, 4: 4, true: 5, false: 6}`,
+	`{"a": [1, {"b": 2}], "c": {}}`,
+	"let newAdder = fn(x) { fn(y) { x + y } }; let addTwo = newAdder(2); addTwo(2)",
+	"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15)",
+	"let counter = fn() { let n = 0; [fn() { n += 1 }, fn() { n }] }; let c = counter(); c[0](); c[0](); c[1]()",
+	"fn(x) { x + 2 }",
+	"[len, fn() { 1 }]",
+	"let f = fn() { g() }; let g = fn() { [1][\"a\"] }; f()",
+	"let f = fn(n) { 1 + f(n + 1) }; f(0)",
+	"let a = fn() { 1 + b() }; let b = fn() { 1 + a() }; a()",
+	"let x = 1; if (x > 0) { let y = 2; } y",
+	"let f = fn(...xs) { xs }; f(...[1, 2], ...[3])",
+	"9223372036854775807 + 1",
+	"7.5 % 2",
+	"fn() {}()",
+	"let f = fn() { let x = 1; }; f()",
+	"let f = fn(x) { if (x) { 1 } }; [f(false), f(true)]",
+	"let f = fn() { while (false) { } }; f()",
+	"let f = fn() { for (x in []) { } }; [f()]",
+	"{}",
+	"",
+	"let f = fn() { let fs = []; let i = 0; while (i < 2) { for (x in [1]) { } let y = i; fs = push(fs, fn() { y }); i += 1; } [fs[0](), fs[1]()] }; f()",
+	`let f = fn() { let fs = []; for (i in [0, 1]) { try { throw(i) } catch (e) { fs = push(fs, fn() { e["value"] }) } } [fs[0](), fs[1]()] }; f()`,
+	`let f = fn() { let fs = []; for (i in [0, 1]) { try { throw(i) } catch (e) { fs = push(fs, fn() { e["value"] }) } finally { 0 } } [fs[0](), fs[1]()] }; f()`,
+}
+
+func TestEnginesAgree(t *testing.T) {
+	programs := append(evaluator.Corpus(), extraPrograms...)
+
+	for _, e := range engines {
+		for _, input := range programs {
+			if divergence(input, e) == "" {
+				continue
+			}
+			minimal := minimize(input, e)
+			t.Errorf("%s differs from the evaluator on\n\t%s\nminimal program:\n\t%s\n%s",
+				e.name, input, minimal, divergence(minimal, e))
+		}
+	}
+}
+
+func TestMinimize(t *testing.T) {
+	// broken gets the sum of two integers wrong.
+	broken := engine{"broken", func(program *ast.Program) object.Object {
+		result := evaluator.Eval(program, object.NewEnvironment())
+		if integer, ok := result.(*object.Integer); ok && integer.Value == 3 {
+			return &object.Integer{Value: 4}
+		}
+		return result
+	}}
+
+	input := "let a = 1; let b = 2; let c = a + 2; puts; c"
+	if divergence(input, broken) == "" {
+		t.Fatalf("engine does not differ on %q", input)
+	}
+	expected := "let a = 1; let c = a + 2; c"
+	if minimal := minimize(input, broken); minimal != expected {
+		t.Errorf("wrong minimal program. expected=%q, got=%q", expected, minimal)
+	}
+}
+
+// divergence describes how the results of e and the evaluator differ for
+// input, or returns "" if they agree. Inputs that do not parse agree.
+func divergence(input string, e engine) string {
+	if _, ok := parse(input); !ok {
+		return ""
+	}
+
+	expected := run(func(program *ast.Program) object.Object {
+		return evaluator.Eval(program, object.NewEnvironment())
+	}, input)
+	actual := run(e.run, input)
+	if expected == actual {
+		return ""
+	}
+	return fmt.Sprintf("evaluator: %s\n%s: %s", expected, e.name, actual)
+}
+
+func run(execute func(program *ast.Program) object.Object, input string) (result string) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = fmt.Sprintf("panic: %v", r)
+		}
+	}()
+
+	program, _ := parse(input)
+	return outcome(execute(program))
+}
+
+// outcome describes the result of a program in a way that does not depend
+// on the engine: functions are not told apart and errors include their
+// stack. A missing result is told apart from null.
+func outcome(obj object.Object) string {
+	switch obj := obj.(type) {
+	case nil:
+		return "no result"
+	case *object.Error:
+		var out strings.Builder
+		out.WriteString(obj.Inspect())
+		for _, line := range obj.Traceback() {
+			out.WriteString("\n\t" + line)
+		}
+		return out.String()
+	case *object.Array:
+		elements := make([]string, len(obj.Elements))
+		for i, element := range obj.Elements {
+			elements[i] = outcome(element)
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case *object.Hash:
+		pairs := []string{}
+		for _, pair := range obj.Ordered() {
+			pairs = append(pairs, outcome(pair.Key)+": "+outcome(pair.Value))
+		}
+		return "{" + strings.Join(pairs, ", ") + "}"
+	case *object.Function, *object.Closure, *object.Builtin:
+		return "function"
+	default:
+		return obj.Inspect()
+	}
+}
+
+// minimize removes top-level statements from input for as long as e still
+// differs from the evaluator on what is left.
+func minimize(input string, e engine) string {
+	for {
+		statements := split(input)
+		shorter := false
+		for i := range statements {
+			candidate := strings.Join(statements[:i], "") + strings.Join(statements[i+1:], "")
+			if len(candidate) < len(input) && divergence(candidate, e) != "" {
+				input, shorter = candidate, true
+				break
+			}
+		}
+		if !shorter {
+			return strings.TrimSpace(input)
+		}
+	}
+}
+
+// split cuts input into its top-level statements.
+func split(input string) []string {
+	program, _ := parse(input)
+	var statements []string
+	end := len(input)
+	for i := len(program.Statements) - 1; i > 0; i-- {
+		start := program.Statements[i].Pos().Offset
+		statements = append([]string{input[start:end]}, statements...)
+		end = start
+	}
+	return append([]string{input[:end]}, statements...)
+}
+
+func parse(input string) (*ast.Program, bool) {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	return program, len(p.ParseErrors()) == 0
+}
+
+func runVM(program *ast.Program) object.Object {
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		return &object.Error{Message: "compile error: " + err.Error()}
+	}
+	return vm.New(comp.Bytecode()).Run()
+}
+
+// runVMFromFile runs the program after writing its bytecode to a compiled
+// program file and reading it back.
+func runVMFromFile(program *ast.Program) object.Object {
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		return &object.Error{Message: "compile error: " + err.Error()}
+	}
+	var buf bytes.Buffer
+	if err := compiler.WriteBytecode(&buf, comp.Bytecode(), true); err != nil {
+		return &object.Error{Message: "write error: " + err.Error()}
+	}
+	bytecode, err := compiler.ReadBytecode(&buf)
+	if err != nil {
+		return &object.Error{Message: "read error: " + err.Error()}
+	}
+	return vm.New(bytecode).Run()
+}
@@ -2,61 +2,116 @@ package evaluator
 
 import (
 	"fmt"
+	"math"
 	"monkey/ast"
 	"monkey/object"
+	"monkey/token"
+	"strings"
 )
 
+// evaluation holds the state of one call to Eval, EvalContext or
+// EvalWithOptions, so that scripts evaluated at the same time do not
+// interfere with each other.
+type evaluation struct {
+	options   Options
+	steps     int64
+	stopped   string // set once evaluation has been interrupted
+	callDepth int
+	args      *object.Builtin // the `args` builtin, made on first use
+}
+
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	return (&evaluation{}).eval(node, env)
+}
+
+func (ev *evaluation) eval(node ast.Node, env *object.Environment) object.Object {
+	var result object.Object
+	if err := ev.checkInterrupt(); err != nil {
+		result = err
+	} else {
+		result = ev.evalNode(node, env)
+	}
+	if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() && node != nil {
+		err.Pos = node.Pos()
+	}
+	return result
+}
+
+func (ev *evaluation) evalNode(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	case *ast.Program:
-		return evalProgram(node.Statements, env)
+		return ev.evalProgram(node.Statements, env)
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return ev.eval(node.Expression, env)
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
 	case *ast.Boolean:
 		return toBooleanObject(node.Value)
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
+		right := ev.eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return evalPrefixExpression(node.Operator, right, ev.options.CheckedArithmetic)
 	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
+		left := ev.eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
-		right := Eval(node.Right, env)
+		right := ev.eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalInfixExpression(node.Operator, left, right)
+		return evalInfixExpression(node.Operator, left, right, ev.options.CheckedArithmetic)
+	case *ast.LogicalExpression:
+		return ev.evalLogicalExpression(node, env)
+	case *ast.AssignExpression:
+		return ev.evalAssignExpression(node, env)
+	case *ast.WhileStatement:
+		return ev.evalWhileStatement(node, env)
+	case *ast.ForStatement:
+		return ev.evalForStatement(node, env)
+	case *ast.BreakStatement:
+		return object.BREAK
+	case *ast.ContinueStatement:
+		return object.CONTINUE
 	case *ast.BlockStatement:
-		return evalStatements(node.Statements, env)
+		return ev.evalStatements(node.Statements, env)
 	case *ast.IfExpression:
-		condition := Eval(node.Condition, env)
+		condition := ev.eval(node.Condition, env)
 		if isError(condition) {
 			return condition
 		}
 		if isTruthy(condition) {
-			return Eval(node.Consequence, env)
+			return ev.eval(node.Consequence, env)
 		} else if node.Alternative != nil {
-			return Eval(node.Alternative, env)
+			return ev.eval(node.Alternative, env)
 		} else {
 			return object.NULL
 		}
+	case *ast.MatchExpression:
+		return ev.evalMatchExpression(node, env)
+	case *ast.TryExpression:
+		return ev.evalTryExpression(node, env)
 	case *ast.ReturnStatement:
-		value := Eval(node.ReturnValue, env)
+		value := ev.eval(node.ReturnValue, env)
 		if isError(value) {
 			return value
 		}
 		return &object.ReturnValue{Value: value}
 	case *ast.LetStatement:
-		value := Eval(node.Value, env)
+		value := ev.eval(node.Value, env)
 		if isError(value) {
 			return value
 		}
+		if node.Pattern != nil {
+			if err := destructure(node.Pattern, value, env); err != nil {
+				return err
+			}
+			break
+		}
 		env.Set(node.Name.Value, value)
 		// return Eval(node, env)
 	case *ast.Identifier:
@@ -64,51 +119,77 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return obj
 		}
 
-		if builtin, ok := builtins[node.Value]; ok {
+		if builtin := ev.builtin(node.Value); builtin != nil {
 			return builtin
 		}
 		return newError("identifier not found: %s", node.Value)
 	case *ast.FunctionLiteral:
 		return &object.Function{
+			Name:       node.Name,
 			Parameters: node.Parameters,
+			Rest:       node.Rest,
 			Body:       node.Body,
 			Env:        env,
 		}
+	case *ast.MacroLiteral:
+		return newError("macro literals must be bound with a top-level let statement")
 	case *ast.CallExpression:
-		function := Eval(node.Function, env)
+		if isSpecialCall(node, "quote", env) {
+			return ev.quote(node, env)
+		}
+		function := ev.eval(node.Function, env)
 		if isError(function) {
 			return function
 		}
-		args := evalExpressions(node.Arguments, env)
-		return applyFunction(function, args)
+		args := ev.evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0]
+		}
+		if node.Tail {
+			return &tailCall{function: function, args: args, pos: node.Pos()}
+		}
+		return ev.applyFunction(function, args, node.Pos())
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 	case *ast.ArrayLiteral:
-		elements := evalExpressions(node.Elements, env)
+		elements := ev.evalExpressions(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
 		return &object.Array{Elements: elements}
 	case *ast.IndexExpression:
-		array := Eval(node.Left, env)
+		array := ev.eval(node.Left, env)
 		if isError(array) {
 			return array
 		}
-		index := Eval(node.Index, env)
+		index := ev.eval(node.Index, env)
 		if isError(index) {
 			return index
 		}
 		return evalIndexExpression(array, index)
-
+	case *ast.HashLiteral:
+		return ev.evalHashLiteral(node, env)
 	}
 	return object.NULL
 }
 
-func evalExpressions(expressions []ast.Expression, env *object.Environment) []object.Object {
+func (ev *evaluation) evalExpressions(expressions []ast.Expression, env *object.Environment) []object.Object {
 	var result []object.Object
 
 	for _, e := range expressions {
-		evaluated := Eval(e, env)
+		if spread, ok := e.(*ast.SpreadExpression); ok {
+			evaluated := ev.eval(spread.Value, env)
+			if isError(evaluated) {
+				return []object.Object{evaluated}
+			}
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				return []object.Object{newError("cannot spread %s", evaluated.Type())}
+			}
+			result = append(result, array.Elements...)
+			continue
+		}
+		evaluated := ev.eval(e, env)
 		if isError(evaluated) {
 			return []object.Object{evaluated}
 		}
@@ -117,16 +198,40 @@ func evalExpressions(expressions []ast.Expression, env *object.Environment) []ob
 	return result
 }
 
-func applyFunction(function object.Object, args []object.Object) object.Object {
-	switch function := function.(type) {
-	case *object.Function:
-		extendedEnv := extendFunctionEnv(function, args)
-		value := Eval(function.Body, extendedEnv)
-		return unwrapReturnValue(value)
-	case *object.Builtin:
-		return function.Fn(args...)
-	default:
-		return newError("not a function: %s", function.Type())
+func (ev *evaluation) applyFunction(function object.Object, args []object.Object, callSite token.Position) object.Object {
+	if max := ev.options.CallDepthLimit(); max > 0 && ev.callDepth >= max {
+		return newError("maximum call depth of %d exceeded", max)
+	}
+	ev.callDepth++
+	defer func() { ev.callDepth-- }()
+
+	for {
+		var result object.Object
+		switch fn := function.(type) {
+		case *object.Function:
+			extendedEnv, err := ev.extendFunctionEnv(fn, args)
+			if err != nil {
+				result = err
+				break
+			}
+			result = unwrapReturnValue(ev.eval(fn.Body, extendedEnv))
+			if call, ok := result.(*tailCall); ok {
+				function, args, callSite = call.function, call.args, call.pos
+				continue
+			}
+			if err, ok := result.(*object.Error); ok {
+				err.AddFrame(object.Frame{Function: fn.Name, Pos: callSite}, MaxStackFrames)
+			}
+		case *object.Builtin:
+			result = fn.Fn(args...)
+		default:
+			result = newError("not a function: %s", function.Type())
+		}
+
+		if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() {
+			err.Pos = callSite
+		}
+		return result
 	}
 }
 
@@ -137,15 +242,141 @@ func unwrapReturnValue(obj object.Object) object.Object {
 	return obj
 }
 
-func extendFunctionEnv(
+func (ev *evaluation) extendFunctionEnv(
 	fn *object.Function,
 	args []object.Object,
-) *object.Environment {
+) (*object.Environment, object.Object) {
+	defaults := numDefaults(fn.Parameters)
+	required := len(fn.Parameters) - defaults
+	if len(args) < required || (fn.Rest == nil && len(args) > len(fn.Parameters)) {
+		return nil, arityError(fn.Name, len(args), len(fn.Parameters), defaults, fn.Rest != nil)
+	}
+
 	env := object.NewEnclosedEnvironment(fn.Env)
 	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx])
+		var value object.Object
+		if paramIdx < len(args) {
+			value = args[paramIdx]
+		} else {
+			value = ev.eval(param.Default, env)
+			if isError(value) {
+				return nil, value
+			}
+		}
+		if param.Pattern != nil {
+			if err := destructure(param.Pattern, value, env); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		env.Set(param.Name.Value, value)
+	}
+	if fn.Rest != nil {
+		rest := []object.Object{}
+		if len(args) > len(fn.Parameters) {
+			rest = append(rest, args[len(fn.Parameters):]...)
+		}
+		env.Set(fn.Rest.Value, &object.Array{Elements: rest})
+	}
+	return env, nil
+}
+
+// numDefaults counts the parameters that have a default value, which are
+// always the last ones.
+func numDefaults(parameters []*ast.Parameter) int {
+	n := 0
+	for _, param := range parameters {
+		if param.Default != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func destructure(pattern ast.Expression, value object.Object, env *object.Environment) *object.Error {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		env.Set(pattern.Value, value)
+	case *ast.ArrayPattern:
+		values, err := destructureArray(value, len(pattern.Elements), pattern.Rest != nil, pattern.String())
+		if err != nil {
+			return err
+		}
+		for i, element := range pattern.Elements {
+			if err := destructure(element, values[i], env); err != nil {
+				return err
+			}
+		}
+		if pattern.Rest != nil {
+			env.Set(pattern.Rest.Value, values[len(values)-1])
+		}
+	case *ast.HashPattern:
+		keys := make([]string, len(pattern.Keys))
+		for i, key := range pattern.Keys {
+			keys[i] = key.Value
+		}
+		values, err := destructureHash(value, keys, pattern.String())
+		if err != nil {
+			return err
+		}
+		for i, key := range keys {
+			env.Set(key, values[i])
+		}
+	}
+	return nil
+}
+
+// destructureArray checks that value is an array with the shape of an
+// array pattern and returns the values for its elements, followed by an
+// array of the remaining elements when the pattern has a rest element.
+func destructureArray(value object.Object, elements int, rest bool, pattern string) ([]object.Object, *object.Error) {
+	array, ok := value.(*object.Array)
+	if !ok {
+		return nil, newError("cannot destructure %s with pattern %s", value.Type(), pattern)
+	}
+	if len(array.Elements) < elements || (!rest && len(array.Elements) > elements) {
+		return nil, newError("cannot destructure array of length %d with pattern %s", len(array.Elements), pattern)
+	}
+
+	values := append([]object.Object{}, array.Elements[:elements]...)
+	if rest {
+		remaining := append([]object.Object{}, array.Elements[elements:]...)
+		values = append(values, &object.Array{Elements: remaining})
 	}
-	return env
+	return values, nil
+}
+
+// destructureHash returns the values stored under keys in the hash value.
+func destructureHash(value object.Object, keys []string, pattern string) ([]object.Object, *object.Error) {
+	hash, ok := value.(*object.Hash)
+	if !ok {
+		return nil, newError("cannot destructure %s with pattern %s", value.Type(), pattern)
+	}
+
+	values := make([]object.Object, len(keys))
+	for i, key := range keys {
+		pair, ok := hash.Pairs[(&object.String{Value: key}).HashKey()]
+		if !ok {
+			return nil, newError("hash has no key %q for pattern %s", key, pattern)
+		}
+		values[i] = pair.Value
+	}
+	return values, nil
+}
+
+func arityError(name string, got, parameters, defaults int, rest bool) *object.Error {
+	if name == "" {
+		name = "anonymous function"
+	} else {
+		name = "`" + name + "`"
+	}
+	want := fmt.Sprintf("%d", parameters)
+	if rest {
+		want = fmt.Sprintf("%d+", parameters-defaults)
+	} else if defaults > 0 {
+		want = fmt.Sprintf("%d..%d", parameters-defaults, parameters)
+	}
+	return newError("wrong number of arguments to %s. got=%d, want=%s", name, got, want)
 }
 
 func isTruthy(obj object.Object) bool {
@@ -169,12 +400,12 @@ func toBooleanObject(value bool) object.Object {
 	}
 }
 
-func evalPrefixExpression(operator string, right object.Object) object.Object {
+func evalPrefixExpression(operator string, right object.Object, checked bool) object.Object {
 	switch operator {
 	case "!":
 		return evalBangOperator(right)
 	case "-":
-		return evalMinusOperator(right)
+		return evalMinusOperator(right, checked)
 	default:
 		return object.NULL
 	}
@@ -193,19 +424,26 @@ func evalBangOperator(right object.Object) object.Object {
 	}
 }
 
-func evalMinusOperator(right object.Object) object.Object {
+func evalMinusOperator(right object.Object, checked bool) object.Object {
 	switch right := right.(type) {
 	case *object.Integer:
+		if checked && right.Value == math.MinInt64 {
+			return newError("integer overflow: -(%d)", right.Value)
+		}
 		return &object.Integer{Value: -right.Value}
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
 	default:
 		return newError("unknown operator: -%s", right.Type())
 	}
 }
 
-func evalInfixExpression(operator string, left object.Object, right object.Object) object.Object {
+func evalInfixExpression(operator string, left object.Object, right object.Object, checked bool) object.Object {
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
-		return evalIntegerInfixExpression(operator, left, right)
+		return evalIntegerInfixExpression(operator, left, right, checked)
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(operator, left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ && operator == "+":
 		leftStr := left.(*object.String)
 		rightStr := right.(*object.String)
@@ -221,18 +459,148 @@ func evalInfixExpression(operator string, left object.Object, right object.Objec
 	}
 }
 
-func evalIntegerInfixExpression(operator string, left object.Object, right object.Object) object.Object {
+func (ev *evaluation) evalLogicalExpression(node *ast.LogicalExpression, env *object.Environment) object.Object {
+	left := ev.eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	switch node.Operator {
+	case "&&":
+		if !isTruthy(left) {
+			return object.FALSE
+		}
+	case "||":
+		if isTruthy(left) {
+			return object.TRUE
+		}
+	default:
+		return newError("unknown operator: %s %s", left.Type(), node.Operator)
+	}
+
+	right := ev.eval(node.Right, env)
+	if isError(right) {
+		return right
+	}
+	return toBooleanObject(isTruthy(right))
+}
+
+func (ev *evaluation) evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		value := ev.eval(node.Value, env)
+		if isError(value) {
+			return value
+		}
+		if node.Operator != "=" {
+			current, ok := env.Get(target.Value)
+			if !ok {
+				return newError("identifier not found: %s", target.Value)
+			}
+			value = evalCompoundOperator(node.Operator, current, value, ev.options.CheckedArithmetic)
+			if isError(value) {
+				return value
+			}
+		}
+		if _, ok := env.Assign(target.Value, value); !ok {
+			return newError("cannot assign to undefined identifier: %s", target.Value)
+		}
+		return value
+	case *ast.IndexExpression:
+		return ev.evalIndexAssignment(node, target, env)
+	default:
+		return newError("cannot assign to %s", node.Target.String())
+	}
+}
+
+func (ev *evaluation) evalIndexAssignment(node *ast.AssignExpression, target *ast.IndexExpression, env *object.Environment) object.Object {
+	container := ev.eval(target.Left, env)
+	if isError(container) {
+		return container
+	}
+	index := ev.eval(target.Index, env)
+	if isError(index) {
+		return index
+	}
+	value := ev.eval(node.Value, env)
+	if isError(value) {
+		return value
+	}
+	if node.Operator != "=" {
+		current := evalIndexExpression(container, index)
+		if isError(current) {
+			return current
+		}
+		value = evalCompoundOperator(node.Operator, current, value, ev.options.CheckedArithmetic)
+		if isError(value) {
+			return value
+		}
+	}
+
+	return setIndex(container, index, value)
+}
+
+func setIndex(container, index, value object.Object) object.Object {
+	switch container := container.(type) {
+	case *object.Array:
+		i, ok := index.(*object.Integer)
+		if !ok {
+			return newError("index operator not supported: %s", index.Type())
+		}
+		if i.Value < 0 || i.Value >= int64(len(container.Elements)) {
+			return newError("index out of range: %d", i.Value)
+		}
+		container.Elements[i.Value] = value
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		container.Set(key.HashKey(), object.HashPair{Key: index, Value: value})
+	default:
+		return newError("index assignment not supported: %s", container.Type())
+	}
+	return value
+}
+
+// evalCompoundOperator applies the arithmetic part of a compound assignment
+// operator such as "+=".
+func evalCompoundOperator(operator string, current, value object.Object, checked bool) object.Object {
+	return evalInfixExpression(strings.TrimSuffix(operator, "="), current, value, checked)
+}
+
+func evalIntegerInfixExpression(operator string, left object.Object, right object.Object, checked bool) object.Object {
 	leftInt := left.(*object.Integer).Value
 	rightInt := right.(*object.Integer).Value
 	switch operator {
 	case "+":
+		if checked && addOverflows(leftInt, rightInt) {
+			return overflowError(leftInt, operator, rightInt)
+		}
 		return &object.Integer{Value: leftInt + rightInt}
 	case "-":
+		if checked && subOverflows(leftInt, rightInt) {
+			return overflowError(leftInt, operator, rightInt)
+		}
 		return &object.Integer{Value: leftInt - rightInt}
 	case "*":
+		if checked && mulOverflows(leftInt, rightInt) {
+			return overflowError(leftInt, operator, rightInt)
+		}
 		return &object.Integer{Value: leftInt * rightInt}
 	case "/":
+		if rightInt == 0 {
+			return newError("division by zero")
+		}
+		if checked && leftInt == math.MinInt64 && rightInt == -1 {
+			return overflowError(leftInt, operator, rightInt)
+		}
 		return &object.Integer{Value: leftInt / rightInt}
+	case "%":
+		if rightInt == 0 {
+			return newError("modulo by zero")
+		}
+		return &object.Integer{Value: leftInt % rightInt}
 	case "==":
 		return toBooleanObject(leftInt == rightInt)
 	case "!=":
@@ -241,15 +609,66 @@ func evalIntegerInfixExpression(operator string, left object.Object, right objec
 		return toBooleanObject(leftInt < rightInt)
 	case ">":
 		return toBooleanObject(leftInt > rightInt)
+	case "<=":
+		return toBooleanObject(leftInt <= rightInt)
+	case ">=":
+		return toBooleanObject(leftInt >= rightInt)
 	default:
 		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
-func evalProgram(statements []ast.Statement, env *object.Environment) object.Object {
-	var result object.Object
+func evalFloatInfixExpression(operator string, left object.Object, right object.Object) object.Object {
+	leftFloat := toFloat(left)
+	rightFloat := toFloat(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftFloat + rightFloat}
+	case "-":
+		return &object.Float{Value: leftFloat - rightFloat}
+	case "*":
+		return &object.Float{Value: leftFloat * rightFloat}
+	case "/":
+		return &object.Float{Value: leftFloat / rightFloat}
+	case "%":
+		return &object.Float{Value: math.Mod(leftFloat, rightFloat)}
+	case "==":
+		return toBooleanObject(leftFloat == rightFloat)
+	case "!=":
+		return toBooleanObject(leftFloat != rightFloat)
+	case "<":
+		return toBooleanObject(leftFloat < rightFloat)
+	case ">":
+		return toBooleanObject(leftFloat > rightFloat)
+	case "<=":
+		return toBooleanObject(leftFloat <= rightFloat)
+	case ">=":
+		return toBooleanObject(leftFloat >= rightFloat)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.Float:
+		return obj.Value
+	default:
+		return 0
+	}
+}
+
+func (ev *evaluation) evalProgram(statements []ast.Statement, env *object.Environment) object.Object {
+	var result object.Object = object.NULL
 	for _, statement := range statements {
-		result = Eval(statement, env)
+		result = ev.eval(statement, env)
 
 		switch result := result.(type) {
 		case *object.ReturnValue:
@@ -261,14 +680,15 @@ func evalProgram(statements []ast.Statement, env *object.Environment) object.Obj
 	return result
 }
 
-func evalStatements(statements []ast.Statement, env *object.Environment) object.Object {
-	var result object.Object
+func (ev *evaluation) evalStatements(statements []ast.Statement, env *object.Environment) object.Object {
+	var result object.Object = object.NULL
 	for _, statement := range statements {
-		result = Eval(statement, env)
+		result = ev.eval(statement, env)
 
 		if result != nil {
 			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ ||
+				rt == object.BREAK_OBJ || rt == object.CONTINUE_OBJ {
 				return result
 			}
 		}
@@ -276,10 +696,194 @@ func evalStatements(statements []ast.Statement, env *object.Environment) object.
 	return result
 }
 
+func (ev *evaluation) evalWhileStatement(node *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := ev.eval(node.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return object.NULL
+		}
+		if result, done := ev.evalLoopBody(node.Body, env); done {
+			return result
+		}
+	}
+}
+
+func (ev *evaluation) evalForStatement(node *ast.ForStatement, env *object.Environment) object.Object {
+	iterable := ev.eval(node.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+
+	items, err := iterationItems(iterable)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		loopEnv := object.NewEnclosedEnvironment(env)
+		loopEnv.Set(node.Variable.Value, item)
+		if result, done := ev.evalLoopBody(node.Body, loopEnv); done {
+			return result
+		}
+	}
+	return object.NULL
+}
+
+// iterationItems returns the values a for loop visits: the elements of an
+// array, the characters of a string or the keys of a hash.
+func iterationItems(iterable object.Object) ([]object.Object, *object.Error) {
+	var items []object.Object
+	switch iterable := iterable.(type) {
+	case *object.Array:
+		items = iterable.Elements
+	case *object.String:
+		for _, r := range iterable.Value {
+			items = append(items, &object.String{Value: string(r)})
+		}
+	case *object.Hash:
+		for _, pair := range iterable.Ordered() {
+			items = append(items, pair.Key)
+		}
+	default:
+		return nil, newError("cannot iterate over %s", iterable.Type())
+	}
+	return items, nil
+}
+
+// evalLoopBody runs one iteration of a loop. It reports done when the loop
+// has to stop, together with the value the loop evaluates to.
+func (ev *evaluation) evalLoopBody(body *ast.BlockStatement, env *object.Environment) (object.Object, bool) {
+	result := ev.eval(body, env)
+	if result == nil {
+		return nil, false
+	}
+	switch result.Type() {
+	case object.RETURN_VALUE_OBJ, object.ERROR_OBJ:
+		return result, true
+	case object.BREAK_OBJ:
+		return object.NULL, true
+	default:
+		return nil, false
+	}
+}
+
+func (ev *evaluation) evalTryExpression(node *ast.TryExpression, env *object.Environment) object.Object {
+	result := ev.eval(node.Block, env)
+
+	if err, ok := result.(*object.Error); ok && node.Catch != nil && !isInterrupt(err) {
+		catchEnv := object.NewEnclosedEnvironment(env)
+		catchEnv.Set(node.Parameter.Value, caughtError(err))
+		result = ev.eval(node.Catch, catchEnv)
+	}
+
+	if node.Finally != nil {
+		// A finally block that errors, returns or leaves a loop overrides
+		// the outcome of the try and catch blocks.
+		final := ev.eval(node.Finally, env)
+		if final != nil {
+			switch final.Type() {
+			case object.RETURN_VALUE_OBJ, object.ERROR_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
+				return final
+			}
+		}
+	}
+	return result
+}
+
+// caughtError exposes an error to a catch block as a hash with the
+// message, the position and the thrown value. Throwing the hash again
+// raises err unchanged.
+func caughtError(err *object.Error) *object.Hash {
+	value := err.Value
+	if value == nil {
+		value = &object.String{Value: err.Message}
+	}
+	fields := []struct {
+		name  string
+		value object.Object
+	}{
+		{"message", &object.String{Value: err.Message}},
+		{"line", &object.Integer{Value: int64(err.Pos.Line)}},
+		{"column", &object.Integer{Value: int64(err.Pos.Column)}},
+		{"value", value},
+	}
+
+	hash := object.NewHash()
+	hash.Caught = err
+	for _, field := range fields {
+		key := &object.String{Value: field.name}
+		hash.Set(key.HashKey(), object.HashPair{Key: key, Value: field.value})
+	}
+	return hash
+}
+
+func (ev *evaluation) evalMatchExpression(node *ast.MatchExpression, env *object.Environment) object.Object {
+	subject := ev.eval(node.Subject, env)
+	if isError(subject) {
+		return subject
+	}
+
+	for _, arm := range node.Arms {
+		for _, pattern := range arm.Patterns {
+			matched, err := ev.matchPattern(pattern, subject, env)
+			if err != nil {
+				return err
+			}
+			if matched {
+				return ev.eval(arm.Body, env)
+			}
+		}
+	}
+	return object.NULL
+}
+
+func (ev *evaluation) matchPattern(pattern ast.Expression, value object.Object, env *object.Environment) (bool, object.Object) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		return pattern.Value == "_", nil
+	case *ast.ArrayLiteral:
+		array, ok := value.(*object.Array)
+		if !ok || len(array.Elements) != len(pattern.Elements) {
+			return false, nil
+		}
+		for i, element := range pattern.Elements {
+			matched, err := ev.matchPattern(element, array.Elements[i], env)
+			if err != nil || !matched {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+
+	expected := ev.eval(pattern, env)
+	if isError(expected) {
+		return false, expected
+	}
+	return objectsEqual(expected, value), nil
+}
+
+func objectsEqual(left, right object.Object) bool {
+	switch {
+	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+		return left.(*object.Integer).Value == right.(*object.Integer).Value
+	case isNumber(left) && isNumber(right):
+		return toFloat(left) == toFloat(right)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return left.(*object.String).Value == right.(*object.String).Value
+	default:
+		return left == right
+	}
+}
+
 func evalIndexExpression(array, index object.Object) object.Object {
 	switch {
 	case array.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(array, index)
+	case array.Type() == object.HASH_OBJ:
+		return evalHashIndexExpression(array, index)
 	default:
 		return newError("index operator not supported: %s", index.Type())
 	}
@@ -296,6 +900,49 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 	return a.Elements[i]
 }
 
+func evalHashIndexExpression(hash, index object.Object) object.Object {
+	h := hash.(*object.Hash)
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", index.Type())
+	}
+	pair, ok := h.Pairs[key.HashKey()]
+	if !ok {
+		return object.NULL
+	}
+	return pair.Value
+}
+
+func (ev *evaluation) evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	hash := object.NewHash()
+
+	for _, pair := range node.Pairs {
+		key := ev.eval(pair.Key, env)
+		if isError(key) {
+			return key
+		}
+		hashKey, err := hashKeyOf(key)
+		if err != nil {
+			return err
+		}
+		value := ev.eval(pair.Value, env)
+		if isError(value) {
+			return value
+		}
+		hash.Set(hashKey, object.HashPair{Key: key, Value: value})
+	}
+
+	return hash
+}
+
+func hashKeyOf(key object.Object) (object.HashKey, *object.Error) {
+	hashable, ok := key.(object.Hashable)
+	if !ok {
+		return object.HashKey{}, newError("unusable as hash key: %s", key.Type())
+	}
+	return hashable.HashKey(), nil
+}
+
 func newError(message string, args ...any) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(message, args...)}
 }
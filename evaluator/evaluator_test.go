@@ -1,110 +1,169 @@
 package evaluator
 
 import (
+	"context"
 	"fmt"
+	"monkey/ast"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
-func TestEvalIntegerExpression(t *testing.T) {
-	tests := []struct {
-		input  string
-		output int64
-	}{
-		{"5", 5},
-		{"10", 10},
-		{"-5", -5},
-		{"-10", -10},
-		{"5 + 5 + 5 + 5 - 10", 10},
-		{"2 * 2 * 2 * 2 * 2", 32},
-		{"-50 + 100 + -50", 0},
-		{"5 * 2 + 10", 20},
-		{"5 + 2 * 10", 25},
-		{"20 + 2 * -10", 0},
-		{"50 / 2 * 2 + 10", 60},
-		{"2 * (5 + 10)", 30},
-		{"3 * 3 * 3 + 10", 37},
-		{"3 * (3 * 3) + 10", 37},
-		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
-	}
+var integerTests = []struct {
+	input  string
+	output int64
+}{
+	{"5", 5},
+	{"10", 10},
+	{"-5", -5},
+	{"-10", -10},
+	{"5 + 5 + 5 + 5 - 10", 10},
+	{"2 * 2 * 2 * 2 * 2", 32},
+	{"-50 + 100 + -50", 0},
+	{"5 * 2 + 10", 20},
+	{"5 + 2 * 10", 25},
+	{"20 + 2 * -10", 0},
+	{"50 / 2 * 2 + 10", 60},
+	{"2 * (5 + 10)", 30},
+	{"3 * 3 * 3 + 10", 37},
+	{"3 * (3 * 3) + 10", 37},
+	{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+	{"7 % 3", 1},
+	{"-7 % 3", -1},
+	{"2 + 7 % 4 * 2", 8},
+}
 
-	for _, test := range tests {
+func TestEvalIntegerExpression(t *testing.T) {
+	for _, test := range integerTests {
 		result := testEval(test.input)
 		testIntegerObject(t, result, test.output)
 	}
 }
 
-func TestEvalBooleanExpressions(t *testing.T) {
-	tests := []struct {
-		input  string
-		output bool
-	}{
-		{"true", true},
-		{"false", false},
-		{"1 < 2", true},
-		{"1 > 2", false},
-		{"1 < 1", false},
-		{"1 > 1", false},
-		{"1 == 1", true},
-		{"1 != 1", false},
-		{"1 == 2", false},
-		{"1 != 2", true},
-		{"true == true", true},
-		{"true == false", false},
-		{"false == true", false},
-		{"false == false", true},
-		{"true != true", false},
-		{"true != false", true},
-		{"false != true", true},
-		{"false != false", false},
-		{"(1 < 2) == true", true},
-		{"(1 < 2) == false", false},
-		{"(1 > 2) == true", false},
-		{"(1 > 2) == false", true},
+var floatTests = []struct {
+	input  string
+	output float64
+}{
+	{"3.5", 3.5},
+	{"-2.5", -2.5},
+	{"1e3", 1000},
+	{"1.5 + 1.5", 3},
+	{"1 + 0.5", 1.5},
+	{"0.5 + 1", 1.5},
+	{"5 / 2.0", 2.5},
+	{"2 * 1.25 - 1", 1.5},
+	{"-(1.5 * 2)", -3},
+}
+
+func TestEvalFloatExpression(t *testing.T) {
+	for _, test := range floatTests {
+		result := testEval(test.input)
+		testFloatObject(t, result, test.output)
 	}
+}
 
-	for _, test := range tests {
+var booleanTests = []struct {
+	input  string
+	output bool
+}{
+	{"true", true},
+	{"false", false},
+	{"1 < 2", true},
+	{"1 > 2", false},
+	{"1 < 1", false},
+	{"1 > 1", false},
+	{"1 == 1", true},
+	{"1 != 1", false},
+	{"1 == 2", false},
+	{"1 != 2", true},
+	{"true == true", true},
+	{"true == false", false},
+	{"false == true", false},
+	{"false == false", true},
+	{"true != true", false},
+	{"true != false", true},
+	{"false != true", true},
+	{"false != false", false},
+	{"(1 < 2) == true", true},
+	{"(1 < 2) == false", false},
+	{"(1 > 2) == true", false},
+	{"(1 > 2) == false", true},
+	{"1.5 < 2", true},
+	{"2 > 1.5", true},
+	{"1 == 1.0", true},
+	{"1.1 != 1", true},
+	{"0.1 + 0.2 > 0.3", true},
+	{"1 <= 2", true},
+	{"2 <= 2", true},
+	{"3 <= 2", false},
+	{"1 >= 2", false},
+	{"2 >= 2", true},
+	{"2.5 >= 2", true},
+	{"1 <= 0.5", false},
+	{"true && true", true},
+	{"true && false", false},
+	{"false || true", true},
+	{"false || false", false},
+	{"1 < 2 && 2 < 3", true},
+	{"1 > 2 || 2 > 3", false},
+	{"false && missing", false},
+	{"true || missing", true},
+	{"if (false) { 1 } && true", false},
+}
+
+func TestEvalBooleanExpressions(t *testing.T) {
+	for _, test := range booleanTests {
 		result := testEval(test.input)
 		testBooleanObject(t, result, test.output)
 	}
 }
 
-func TestBangOperator(t *testing.T) {
-	tests := []struct {
-		input  string
-		output bool
-	}{
-		{"!true", false},
-		{"!false", true},
-		{"!5", false},
-		{"!!true", true},
-		{"!!false", false},
-		{"!!5", true},
-	}
+func TestEvalFloatModulo(t *testing.T) {
+	testFloatObject(t, testEval("7.5 % 2"), 1.5)
+}
 
-	for _, test := range tests {
+var bangOperatorTests = []struct {
+	input  string
+	output bool
+}{
+	{"!true", false},
+	{"!false", true},
+	{"!5", false},
+	{"!!true", true},
+	{"!!false", false},
+	{"!!5", true},
+}
+
+func TestBangOperator(t *testing.T) {
+	for _, test := range bangOperatorTests {
 		result := testEval(test.input)
 		testBooleanObject(t, result, test.output)
 	}
 }
 
-func TestIfElseExpressions(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected any
-	}{
-		{"if (true) { 10 }", 10},
-		{"if (false) { 10 }", nil},
-		{"if (1) { 10 }", 10},
-		{"if (1 < 2) { 10 }", 10},
-		{"if (1 > 2) { 10 }", nil},
-		{"if (1 > 2) { 10 } else { 20 }", 20},
-		{"if (1 < 2) { 10 } else { 20 }", 10},
-	}
+var ifElseTests = []struct {
+	input    string
+	expected any
+}{
+	{"if (true) { 10 }", 10},
+	{"if (false) { 10 }", nil},
+	{"if (1) { 10 }", 10},
+	{"if (1 < 2) { 10 }", 10},
+	{"if (1 > 2) { 10 }", nil},
+	{"if (1 > 2) { 10 } else { 20 }", 20},
+	{"if (1 < 2) { 10 } else { 20 }", 10},
+	{"if (1 > 2) { 10 } else if (2 > 1) { 20 } else { 30 }", 20},
+	{"if (1 > 2) { 10 } else if (2 > 3) { 20 } else { 30 }", 30},
+	{"if (1 > 2) { 10 } else if (2 > 3) { 20 }", nil},
+	{"if (false) { 1 } else if (false) { 2 } else if (true) { 3 } else { 4 }", 3},
+}
 
-	for _, tt := range tests {
+func TestIfElseExpressions(t *testing.T) {
+	for _, tt := range ifElseTests {
 		evaluated := testEval(tt.input)
 		integer, ok := tt.expected.(int)
 		if ok {
@@ -115,72 +174,98 @@ func TestIfElseExpressions(t *testing.T) {
 	}
 }
 
-func TestReturnStatements(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected int64
-	}{
-		{"return 10;", 10},
-		{"return 10; 9;", 10},
-		{"return 2 * 5; 9;", 10},
-		{"9; return 2 * 5; 9;", 10},
-		{`if (10 > 1) {
+var returnTests = []struct {
+	input    string
+	expected int64
+}{
+	{"return 10;", 10},
+	{"return 10; 9;", 10},
+	{"return 2 * 5; 9;", 10},
+	{"9; return 2 * 5; 9;", 10},
+	{`if (10 > 1) {
 			if (10 > 1) {
 				return 10;
 			}
 			return 1;
 		}`, 10},
-	}
-	for _, tt := range tests {
+}
+
+func TestReturnStatements(t *testing.T) {
+	for _, tt := range returnTests {
 		evaluated := testEval(tt.input)
 		testIntegerObject(t, evaluated, tt.expected)
 	}
 }
 
-func TestErrorHandling(t *testing.T) {
-	tests := []struct {
-		input           string
-		expectedMessage string
-	}{
-		{
-			"5 + true;",
-			"type mismatch: INTEGER + BOOLEAN",
-		},
-		{
-			"5 + true; 5;",
-			"type mismatch: INTEGER + BOOLEAN",
-		},
-		{
-			"-true",
-			"unknown operator: -BOOLEAN",
-		},
-		{
-			"true + false;",
-			"unknown operator: BOOLEAN + BOOLEAN",
-		},
-		{
-			"5; true + false; 5",
-			"unknown operator: BOOLEAN + BOOLEAN",
-		},
-		{
-			"if (10 > 1) { true + false; }",
-			"unknown operator: BOOLEAN + BOOLEAN",
-		},
-		{
-			`if (10 > 1) {
+var errorHandlingTests = []struct {
+	input           string
+	expectedMessage string
+}{
+	{
+		"5 + true;",
+		"type mismatch: INTEGER + BOOLEAN",
+	},
+	{
+		"5 + true; 5;",
+		"type mismatch: INTEGER + BOOLEAN",
+	},
+	{
+		"-true",
+		"unknown operator: -BOOLEAN",
+	},
+	{
+		"true + false;",
+		"unknown operator: BOOLEAN + BOOLEAN",
+	},
+	{
+		"5; true + false; 5",
+		"unknown operator: BOOLEAN + BOOLEAN",
+	},
+	{
+		"if (10 > 1) { true + false; }",
+		"unknown operator: BOOLEAN + BOOLEAN",
+	},
+	{
+		`if (10 > 1) {
 			if (10 > 1) {
 				return true + false;
 			}
 			return 1;
 		}
 	`, "unknown operator: BOOLEAN + BOOLEAN",
-		},
-		{
-			`"Hello" - "world"`,
-			"unknown operator: STRING - STRING",
-		},
-	}
-	for _, tt := range tests {
+	},
+	{
+		`"Hello" - "world"`,
+		"unknown operator: STRING - STRING",
+	},
+	{
+		"1 / 0",
+		"division by zero",
+	},
+	{
+		"10 % (5 - 5)",
+		"modulo by zero",
+	},
+	{
+		"true && missing",
+		"identifier not found: missing",
+	},
+	{
+		"false || 1 + true",
+		"type mismatch: INTEGER + BOOLEAN",
+	},
+	{
+		`{"name": "Monkey"}[fn(x) { x }];`,
+		"unusable as hash key: FUNCTION",
+	},
+	{
+		`{fn(x) { x }: "Monkey"};`,
+		"unusable as hash key: FUNCTION",
+	},
+}
+
+func TestErrorHandling(t *testing.T) {
+	for _, tt := range errorHandlingTests {
 		evaluated := testEval(tt.input)
 		errObj, ok := evaluated.(*object.Error)
 		if !ok {
@@ -194,6 +279,264 @@ func TestErrorHandling(t *testing.T) {
 		}
 	}
 }
+
+var errorPositionTests = []struct {
+	input       string
+	expectedPos string
+}{
+	{"foobar", "1:1"},
+	{"let x = 1;\n  x + true", "2:3"},
+	{"let f = fn() {\n  missing\n};\nf()", "2:3"},
+	{`len(1, 2)`, "1:1"},
+	{"let g = fn() {\n  throw(\"x\")\n};\ntry { g() } catch (e) { throw(e) }", "2:3"},
+}
+
+func TestErrorPositions(t *testing.T) {
+	for _, tt := range errorPositionTests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Pos.String() != tt.expectedPos {
+			t.Errorf("wrong error position. expected=%s, got=%s", tt.expectedPos, errObj.Pos)
+		}
+	}
+}
+
+var errorStackTests = []struct {
+	input    string
+	expected []string
+}{
+	{"1 + true", []string{}},
+	{"let add = fn(a, b) { a + b };\nadd(1, true)", []string{"in `add` called at 2:1"}},
+	{
+		"let inner = fn() { missing };\nlet outer = fn() {\n  inner() + 1\n};\nouter()",
+		[]string{"in `inner` called at 3:3", "in `outer` called at 5:1"},
+	},
+	{"let inner = fn() { missing };\nlet outer = fn() { inner() };\nouter()", []string{"in `inner` called at 2:20"}},
+	{"fn() { throw(\"x\"); 1 }()", []string{"in anonymous function called at 1:1"}},
+	{"let f = fn(a) { a };\nf(1, 2)", []string{}},
+	{"let f = fn() { try { g() } catch (e) { 1 } + true };\nlet g = fn() { throw(\"x\") };\nf()", []string{"in `f` called at 3:1"}},
+	{
+		"let g = fn() { throw(\"x\"); 1 };\nlet f = fn() { try { g() } catch (e) { throw(e) } };\nf()",
+		[]string{"in `g` called at 2:22", "in `f` called at 3:1"},
+	},
+}
+
+func TestErrorStack(t *testing.T) {
+	for _, tt := range errorStackTests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if len(errObj.Stack) != len(tt.expected) {
+			t.Errorf("%q: wrong stack depth. expected=%d, got=%d", tt.input, len(tt.expected), len(errObj.Stack))
+			continue
+		}
+		for i, frame := range errObj.Stack {
+			if frame.String() != tt.expected[i] {
+				t.Errorf("%q: wrong frame %d. expected=%q, got=%q", tt.input, i, tt.expected[i], frame.String())
+			}
+		}
+	}
+}
+
+var tailCallTests = []struct {
+	input    string
+	expected string
+}{
+	{"let countdown = fn(n) { if (n == 0) { 0 } else { countdown(n - 1) } }; countdown(100000)", "0"},
+	{"let countdown = fn(n) { if (n == 0) { return 0; } return countdown(n - 1); }; countdown(100000)", "0"},
+	{"let sum = fn(n, acc) { match (n) { 0 => acc, _ => sum(n - 1, acc + n) } }; sum(100000, 0)", "5000050000"},
+	{"let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } }; let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } }; even(100001)", "false"},
+	{"let f = fn(n) { while (true) { if (n == 0) { return n; } return f(n - 1); } }; f(100000)", "0"},
+	{"let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(2000)", "2000"},
+	{"let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(2000000)", "maximum call depth of 10000 exceeded"},
+	{"let f = fn(n) { if (n == 0) { throw(\"done\") } else { try { f(n - 1) } catch (e) { e[\"message\"] } } }; f(3)", "done"},
+	{"let f = fn() { len(1) }; f()", "argument to `len` not supported, got INTEGER"},
+}
+
+func TestTailCalls(t *testing.T) {
+	for _, test := range tailCallTests {
+		evaluated := testEval(test.input)
+		if err, ok := evaluated.(*object.Error); ok {
+			if err.Message != test.expected {
+				t.Errorf("%s: wrong error message. expected=%q, got=%q", test.input, test.expected, err.Message)
+			}
+			continue
+		}
+		if evaluated.Inspect() != test.expected {
+			t.Errorf("%s: expected %s, got=%s", test.input, test.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestMaxCallDepth(t *testing.T) {
+	opts := Options{MaxCallDepth: 50}
+	evaluated := testEvalWithOptions("let f = fn(n) { 1 + f(n + 1) }; f(0)", opts)
+	err, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if err.Message != "maximum call depth of 50 exceeded" {
+		t.Errorf("wrong error message. got=%q", err.Message)
+	}
+	expected := "in `f` called at 1:21\n... 48 more\nin `f` called at 1:33"
+	if actual := strings.Join(err.Traceback(), "\n"); actual != expected {
+		t.Errorf("wrong traceback.\nexpected=%q\ngot=     %q", expected, actual)
+	}
+
+	// Frames that do not repeat are dropped from the middle of the stack,
+	// keeping the outermost call.
+	evaluated = testEvalWithOptions("let a = fn() { 1 + b() };\nlet b = fn() { 1 + a() };\na()", Options{MaxCallDepth: 300})
+	err, ok = evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if len(err.Stack) != MaxStackFrames || err.Omitted != 300-MaxStackFrames {
+		t.Errorf("wrong stack. expected %d frames and %d omitted, got %d and %d", MaxStackFrames, 300-MaxStackFrames, len(err.Stack), err.Omitted)
+	}
+	if last := err.Stack[len(err.Stack)-1].String(); last != "in `a` called at 3:1" {
+		t.Errorf("wrong outermost frame. got=%q", last)
+	}
+
+	// The depth is restored after each call, so nesting up to the limit
+	// twice in one script is fine.
+	testIntegerObject(t, testEvalWithOptions("let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(49); f(49)", opts), 49)
+
+	unlimited := Options{MaxCallDepth: -1}
+	testIntegerObject(t, testEvalWithOptions("let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(20000)", unlimited), 20000)
+}
+
+func TestEvalContext(t *testing.T) {
+	parse := func(input string) *ast.Program {
+		return parser.New(lexer.New(input)).ParseProgram()
+	}
+
+	t.Run("timeout", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		evaluated := EvalContext(ctx, parse("while (true) { }"), object.NewEnvironment(), 0)
+		if !IsTimeout(evaluated) {
+			t.Fatalf("expected timeout error, got=%s", evaluated.Inspect())
+		}
+		if IsBudgetExceeded(evaluated) {
+			t.Errorf("timeout reported as budget exceeded")
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		evaluated := EvalContext(ctx, parse("let f = fn(n) { f(n + 1) }; f(0)"), object.NewEnvironment(), 0)
+		if !IsTimeout(evaluated) || evaluated.(*object.Error).Message != "evaluation canceled" {
+			t.Fatalf("expected cancellation error, got=%s", evaluated.Inspect())
+		}
+	})
+
+	t.Run("budget", func(t *testing.T) {
+		input := "let i = 0; while (true) { try { i += 1; } catch (e) { 0 } finally { 1 } }"
+		evaluated := EvalContext(context.Background(), parse(input), object.NewEnvironment(), 1000)
+		if !IsBudgetExceeded(evaluated) {
+			t.Fatalf("expected budget error, got=%s", evaluated.Inspect())
+		}
+		if IsTimeout(evaluated) {
+			t.Errorf("budget exceeded reported as timeout")
+		}
+	})
+
+	t.Run("within budget", func(t *testing.T) {
+		evaluated := EvalContext(context.Background(), parse("let x = 1; x + 2"), object.NewEnvironment(), 1000)
+		testIntegerObject(t, evaluated, 3)
+	})
+
+	t.Run("thrown message", func(t *testing.T) {
+		evaluated := EvalContext(context.Background(), parse(`throw("step budget exceeded")`), object.NewEnvironment(), 0)
+		if IsBudgetExceeded(evaluated) {
+			t.Errorf("thrown value reported as budget exceeded")
+		}
+	})
+
+	t.Run("limits reset", func(t *testing.T) {
+		testIntegerObject(t, testEval("let i = 0; while (i < 5000) { i += 1; } i"), 5000)
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+
+		var wg sync.WaitGroup
+		results := make([]object.Object, 8)
+		for i := range results {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if i%2 == 0 {
+					results[i] = EvalContext(ctx, parse("while (true) { }"), object.NewEnvironment(), 0)
+					return
+				}
+				input := "let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(20)"
+				results[i] = EvalContext(context.Background(), parse(input), object.NewEnvironment(), 0)
+			}(i)
+		}
+		wg.Wait()
+
+		for i, result := range results {
+			if i%2 == 0 {
+				if !IsTimeout(result) {
+					t.Errorf("script %d: expected timeout error, got=%s", i, result.Inspect())
+				}
+				continue
+			}
+			testIntegerObject(t, result, 6765)
+		}
+	})
+}
+
+func TestCheckedArithmetic(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"9223372036854775807 + 1", "integer overflow: 9223372036854775807 + 1"},
+		{"-9223372036854775807 - 2", "integer overflow: -9223372036854775807 - 2"},
+		{"4611686018427387904 * 2", "integer overflow: 4611686018427387904 * 2"},
+		{"(-9223372036854775807 - 1) / -1", "integer overflow: -9223372036854775808 / -1"},
+		{"-(-9223372036854775807 - 1)", "integer overflow: -(-9223372036854775808)"},
+		{"9223372036854775806 + 1", 9223372036854775807},
+		{"-4611686018427387904 * 2", -9223372036854775808},
+		{"3037000499 * 3037000499", 9223372030926249001},
+	}
+
+	opts := Options{CheckedArithmetic: true}
+	for _, test := range tests {
+		evaluated := testEvalWithOptions(test.input, opts)
+		switch expected := test.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			err, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if err.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, err.Message)
+			}
+		}
+	}
+}
+
+func TestUncheckedArithmeticWraps(t *testing.T) {
+	testIntegerObject(t, testEval("9223372036854775807 + 1"), -9223372036854775808)
+}
+
 func TestFunctionObject(t *testing.T) {
 	input := "fn(x) { x + 2; };"
 	evaluated := testEval(input)
@@ -214,23 +557,286 @@ func TestFunctionObject(t *testing.T) {
 	}
 }
 
+var functionApplicationTests = []struct {
+	input    string
+	expected int64
+}{
+	{"let identity = fn(x) { x; }; identity(5);", 5},
+	{"let identity = fn(x) { return x; }; identity(5);", 5},
+	{"let double = fn(x) { x * 2; }; double(5);", 10},
+	{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+	{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+	{"fn(x) { x; }(5)", 5},
+	{"let quote = fn(x) { x + 1 }; quote(1)", 2},
+	{"let f = fn(quote) { quote(2) }; f(fn(x) { x * 3 })", 6},
+}
+
 func TestFunctionApplication(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected int64
-	}{
-		{"let identity = fn(x) { x; }; identity(5);", 5},
-		{"let identity = fn(x) { return x; }; identity(5);", 5},
-		{"let double = fn(x) { x * 2; }; double(5);", 10},
-		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
-		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
-		{"fn(x) { x; }(5)", 5},
-	}
-	for _, tt := range tests {
+	for _, tt := range functionApplicationTests {
 		testIntegerObject(t, testEval(tt.input), tt.expected)
 	}
 }
 
+var functionArityTests = []struct {
+	input    string
+	expected any
+}{
+	{"let add = fn(a, b) { a + b }; add(1);", "wrong number of arguments to `add`. got=1, want=2"},
+	{"let add = fn(a, b) { a + b }; add(1, 2, 3);", "wrong number of arguments to `add`. got=3, want=2"},
+	{"fn(x) { x }();", "wrong number of arguments to anonymous function. got=0, want=1"},
+	{"let add = fn(a, b = 2) { a + b }; add();", "wrong number of arguments to `add`. got=0, want=1..2"},
+	{"let add = fn(a, b = 2) { a + b }; add(1);", 3},
+	{"let add = fn(a, b = 2) { a + b }; add(1, 5);", 6},
+	{"let f = fn(a, b = a * 10) { a + b }; f(1);", 11},
+	{"let y = 100; let f = fn(a = y) { a }; f();", 100},
+	{"let f = fn(a = missing) { a }; f();", "identifier not found: missing"},
+	{"let f = fn(a) { a }; f(missing);", "identifier not found: missing"},
+}
+
+func TestFunctionArity(t *testing.T) {
+	for _, test := range functionArityTests {
+		evaluated := testEval(test.input)
+		switch expected := test.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			err, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if err.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, err.Message)
+			}
+		}
+	}
+}
+
+var variadicTests = []struct {
+	input    string
+	expected any
+}{
+	{"let f = fn(first, ...rest) { rest }; f(1, 2, 3);", "[2, 3]"},
+	{"let f = fn(first, ...rest) { rest }; f(1);", "[]"},
+	{"let f = fn(...all) { len(all) }; f(1, 2, 3, 4);", "4"},
+	{"let f = fn(a, b = 2, ...rest) { [a, b, rest] }; f(1);", "[1, 2, []]"},
+	{"let f = fn(a, b = 2, ...rest) { [a, b, rest] }; f(1, 3, 5, 7);", "[1, 3, [5, 7]]"},
+	{"let add = fn(a, b) { a + b }; let xs = [1, 2]; add(...xs);", "3"},
+	{"let xs = [2, 3]; [1, ...xs, 4, ...[]];", "[1, 2, 3, 4]"},
+	{"let f = fn(...all) { all }; f(0, ...[1, 2], 3);", "[0, 1, 2, 3]"},
+	{"len(...[\"abc\"])", "3"},
+	{"let f = fn(a, ...rest) { a }; f();", "wrong number of arguments to `f`. got=0, want=1+"},
+	{"let add = fn(a, b) { a + b }; add(...[1, 2, 3]);", "wrong number of arguments to `add`. got=3, want=2"},
+	{"[...5]", "cannot spread INTEGER"},
+}
+
+func TestVariadicFunctions(t *testing.T) {
+	for _, test := range variadicTests {
+		evaluated := testEval(test.input)
+		if err, ok := evaluated.(*object.Error); ok {
+			if err.Message != test.expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", test.expected, err.Message)
+			}
+			continue
+		}
+		if evaluated.Inspect() != test.expected {
+			t.Errorf("expected %s, got=%s", test.expected, evaluated.Inspect())
+		}
+	}
+}
+
+var assignmentTests = []struct {
+	input    string
+	expected string
+}{
+	{"let x = 1; x = 2; x", "2"},
+	{"let x = 1; x = x + 1", "2"},
+	{"let x = 1; let y = 2; x = y = 3; x + y", "6"},
+	{"let x = 10; x += 5; x -= 3; x *= 2; x /= 4; x", "6"},
+	{`let s = "a"; s += "b"; s`, "ab"},
+	{"let f = 1.5; f *= 2; f", "3.0"},
+	{"let counter = 0; let inc = fn() { counter += 1 }; inc(); inc(); counter", "2"},
+	{"let x = 1; let f = fn() { let x = 5; x = 6; x }; [f(), x]", "[6, 1]"},
+	{"let arr = [1, 2, 3]; arr[1] = 20; arr", "[1, 20, 3]"},
+	{"let arr = [1, 2, 3]; arr[2] *= 10; arr", "[1, 2, 30]"},
+	{"let a = [1]; let b = a; b[0] = 2; a", "[2]"},
+	{`let h = {"a": 1}; h["a"] += 1; h["b"] = 5; [h["a"], h["b"]]`, "[2, 5]"},
+	{"x = 1", "cannot assign to undefined identifier: x"},
+	{"x += 1", "identifier not found: x"},
+	{"let x = 1; x += true", "type mismatch: INTEGER + BOOLEAN"},
+	{"let arr = [1]; arr[1] = 2", "index out of range: 1"},
+	{"let arr = [1]; arr[-1] = 2", "index out of range: -1"},
+	{`let arr = [1]; arr["a"] = 2`, "index operator not supported: STRING"},
+	{`let h = {}; h[fn() {}] = 1`, "unusable as hash key: FUNCTION"},
+	{`let s = "abc"; s[0] = "x"`, "index assignment not supported: STRING"},
+}
+
+func TestAssignment(t *testing.T) {
+	for _, test := range assignmentTests {
+		evaluated := testEval(test.input)
+		if err, ok := evaluated.(*object.Error); ok {
+			if err.Message != test.expected {
+				t.Errorf("%s: wrong error message. expected=%q, got=%q", test.input, test.expected, err.Message)
+			}
+			continue
+		}
+		if evaluated.Inspect() != test.expected {
+			t.Errorf("%s: expected %s, got=%s", test.input, test.expected, evaluated.Inspect())
+		}
+	}
+}
+
+var destructuringTests = []struct {
+	input    string
+	expected string
+}{
+	{"let [a, b] = [1, 2]; a + b", "3"},
+	{"let [a, ...tail] = [1, 2, 3]; tail", "[2, 3]"},
+	{"let [a, ...tail] = [1]; tail", "[]"},
+	{"let [[a, b], c] = [[1, 2], 3]; a + b + c", "6"},
+	{`let {name} = {"name": "Ada", "age": 36}; name`, "Ada"},
+	{`let {name, age} = {"name": "Ada", "age": 36}; age`, "36"},
+	{`let [{name}, ...others] = [{"name": "a"}, 1]; name`, "a"},
+	{"let first = fn([a, _]) { a }; first([5, 6])", "5"},
+	{`let greet = fn({name}, greeting = "hi") { greeting + " " + name }; greet({"name": "Bo"})`, "hi Bo"},
+	{"let f = fn([a, b] = [1, 2]) { a * b }; f()", "2"},
+	{"let f = fn([a] = [1], [a] = [a + 1]) { a }; f()", "2"},
+	{"let f = fn([a], [b]) { a - b }; f([5], [3])", "2"},
+	{"let [a, b] = [1, 2, 3];", "cannot destructure array of length 3 with pattern [a, b]"},
+	{"let [a, b, ...c] = [1];", "cannot destructure array of length 1 with pattern [a, b, ...c]"},
+	{"let [a] = 5;", "cannot destructure INTEGER with pattern [a]"},
+	{"let {a} = [1];", "cannot destructure ARRAY with pattern {a}"},
+	{`let {a, b} = {"a": 1};`, `hash has no key "b" for pattern {a, b}`},
+	{"let f = fn([a, b]) { a }; f([1])", "cannot destructure array of length 1 with pattern [a, b]"},
+}
+
+func TestDestructuring(t *testing.T) {
+	for _, test := range destructuringTests {
+		evaluated := testEval(test.input)
+		if err, ok := evaluated.(*object.Error); ok {
+			if err.Message != test.expected {
+				t.Errorf("%s: wrong error message. expected=%q, got=%q", test.input, test.expected, err.Message)
+			}
+			continue
+		}
+		if evaluated.Inspect() != test.expected {
+			t.Errorf("%s: expected %s, got=%s", test.input, test.expected, evaluated.Inspect())
+		}
+	}
+}
+
+var tryCatchTests = []struct {
+	input    string
+	expected string
+}{
+	{`try { throw("boom") } catch (e) { e["message"] }`, "boom"},
+	{`try { 1 + true } catch (e) { e["message"] }`, "type mismatch: INTEGER + BOOLEAN"},
+	{`try { 1 } catch (e) { 2 }`, "1"},
+	{`try { throw(42) } catch (e) { e["value"] + 1 }`, "43"},
+	{`try { throw([1, 2]) } catch (e) { e["message"] }`, "[1, 2]"},
+	{"try {\n  let x = 1;\n  throw(\"boom\");\n} catch (e) { [e[\"line\"], e[\"column\"]] }", "[3, 3]"},
+	{`let f = fn() { throw("deep") }; try { f() } catch (e) { e["message"] }`, "deep"},
+	{`let log = []; try { throw("x") } catch (e) { log = push(log, "catch") } finally { log = push(log, "finally") }; log`, `[catch, finally]`},
+	{`let log = []; try { 1 } finally { log = push(log, "finally") }; log`, `[finally]`},
+	{`let x = 0; let f = fn() { try { return 1; } finally { x = 2; } }; f() + x`, "3"},
+	{`try { throw("a") } catch (e) { throw("b") }`, "b"},
+	{`try { throw("a") } catch (e) { throw(e) }`, "a"},
+	{`try { 1 + true } catch (e) { throw(e) }`, "type mismatch: INTEGER + BOOLEAN"},
+	{`try { try { throw([1]) } catch (e) { throw(e) } } catch (e) { [e["message"], e["value"], e["line"], e["column"]] }`, "[[1], [1], 1, 13]"},
+	{`try { throw("a") } catch (e) { throw({"message": "a"}) }`, "{message: a}"},
+	{`try { throw("a") } finally { 1 }`, "a"},
+	{`try { 1 } finally { throw("from finally") }`, "from finally"},
+	{`try { throw("a") } catch (e) { 1 }; e`, "identifier not found: e"},
+	{`throw("uncaught"); 1`, "uncaught"},
+	{`throw(1, 2)`, "wrong number of arguments. got=2, want=1"},
+	{`let i = 0; while (true) { try { i += 1; if (i == 3) { break; } } catch (e) { 0 } } i`, "3"},
+}
+
+func TestTryCatch(t *testing.T) {
+	for _, test := range tryCatchTests {
+		evaluated := testEval(test.input)
+		if err, ok := evaluated.(*object.Error); ok {
+			if err.Message != test.expected {
+				t.Errorf("%s: wrong error message. expected=%q, got=%q", test.input, test.expected, err.Message)
+			}
+			continue
+		}
+		if evaluated.Inspect() != test.expected {
+			t.Errorf("%s: expected %s, got=%s", test.input, test.expected, evaluated.Inspect())
+		}
+	}
+}
+
+var loopTests = []struct {
+	input    string
+	expected string
+}{
+	{"let i = 0; while (i < 5) { i += 1; } i", "5"},
+	{"let i = 0; while (false) { i += 1; }", "null"},
+	{"let sum = 0; for (x in [1, 2, 3]) { sum += x; } sum", "6"},
+	{`let out = ""; for (c in "héllo") { out = c + out; } out`, "olléh"},
+	{`let h = {"a": 1, "b": 2}; let sum = 0; for (k in h) { sum += h[k]; } sum`, "3"},
+	{"let i = 0; while (true) { i += 1; if (i == 3) { break; } } i", "3"},
+	{"let sum = 0; for (x in [1, 2, 3, 4]) { if (x % 2 == 0) { continue; } sum += x; } sum", "4"},
+	{"let f = fn() { for (x in [1, 2, 3]) { if (x == 2) { return x * 10; } } 0 }; f()", "20"},
+	{"let n = 0; for (x in [1, 2]) { for (y in [1, 2, 3]) { if (y == 2) { break; } n += 1; } } n", "2"},
+	{"let fns = []; for (x in [1, 2]) { fns = push(fns, fn() { x }); } fns[0]() + fns[1]()", "3"},
+	{"let i = 0; while (i < 100000) { i += 1; } i", "100000"},
+	{"for (x in 5) { }", "cannot iterate over INTEGER"},
+	{"while (missing) { }", "identifier not found: missing"},
+	{"for (x in [1]) { x + true; }", "type mismatch: INTEGER + BOOLEAN"},
+}
+
+func TestLoops(t *testing.T) {
+	for _, test := range loopTests {
+		evaluated := testEval(test.input)
+		if err, ok := evaluated.(*object.Error); ok {
+			if err.Message != test.expected {
+				t.Errorf("%s: wrong error message. expected=%q, got=%q", test.input, test.expected, err.Message)
+			}
+			continue
+		}
+		if evaluated.Inspect() != test.expected {
+			t.Errorf("%s: expected %s, got=%s", test.input, test.expected, evaluated.Inspect())
+		}
+	}
+}
+
+var matchTests = []struct {
+	input    string
+	expected string
+}{
+	{`match (2) { 1, 2 => "small", _ => "large" }`, "small"},
+	{`match (7) { 1, 2 => "small", _ => "large" }`, "large"},
+	{`match ("b") { "a" => 1, "b" => 2 }`, "2"},
+	{`match (true) { false => 0, true => 1 }`, "1"},
+	{`match (2.0) { 2 => "two" }`, "two"},
+	{`match (-3) { -3 => "minus three" }`, "minus three"},
+	{`match ([1, 2]) { [1] => "one", [1, _] => "pair" }`, "pair"},
+	{`match ([1, [2, 3]]) { [_, [2, _]] => "nested" }`, "nested"},
+	{`match ("1") { 1 => "int", "1" => "string" }`, "string"},
+	{`match (5) { 1 => "one" }`, "null"},
+	{`match (5) { _ => { let x = 2; x * 10 } }`, "20"},
+	{`let f = fn(n) { match (n) { 0 => { return "zero"; }, _ => "other" } }; f(0)`, "zero"},
+	{`match (missing) { _ => 1 }`, "identifier not found: missing"},
+	{`match (1) { 1 => 1 + true }`, "type mismatch: INTEGER + BOOLEAN"},
+}
+
+func TestMatchExpressions(t *testing.T) {
+	for _, test := range matchTests {
+		evaluated := testEval(test.input)
+		if err, ok := evaluated.(*object.Error); ok {
+			if err.Message != test.expected {
+				t.Errorf("%s: wrong error message. expected=%q, got=%q", test.input, test.expected, err.Message)
+			}
+			continue
+		}
+		if evaluated.Inspect() != test.expected {
+			t.Errorf("%s: expected %s, got=%s", test.input, test.expected, evaluated.Inspect())
+		}
+	}
+}
+
 func TestClosures(t *testing.T) {
 	input := `
 		let newAdder = fn(x) {
@@ -270,19 +876,20 @@ func TestStringConcatenation(t *testing.T) {
 	}
 }
 
-func TestBuiltinFunctrions(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected any
-	}{
-		{`len("")`, 0},
-		{`len("four")`, 4},
-		{`len("hello world")`, 11},
-		{`len(1)`, "argument to `len` not supported, got INTEGER"},
-		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
-	}
+var builtinTests = []struct {
+	input    string
+	expected any
+}{
+	{`len("")`, 0},
+	{`len("four")`, 4},
+	{`len("hello world")`, 11},
+	{`len(1)`, "argument to `len` not supported, got INTEGER"},
+	{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+	{`len({"a": 1, "b": 2})`, 2},
+}
 
-	for _, test := range tests {
+func TestBuiltinFunctrions(t *testing.T) {
+	for _, test := range builtinTests {
 		evaluated := testEval(test.input)
 
 		switch expected := test.expected.(type) {
@@ -303,6 +910,42 @@ func TestBuiltinFunctrions(t *testing.T) {
 	}
 }
 
+func TestArgsBuiltin(t *testing.T) {
+	evaluated := testEvalWithOptions(`args()`, Options{Args: []string{"one", "two"}})
+	array, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("expected Array. got=%T (%+v)", evaluated, evaluated)
+	}
+	if array.Inspect() != "[one, two]" {
+		t.Errorf("expected [one, two], got=%s", array.Inspect())
+	}
+
+	// Each evaluation sees its own arguments.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(arg string) {
+			defer wg.Done()
+			evaluated := testEvalWithOptions(`args()[0]`, Options{Args: []string{arg}})
+			if evaluated.Inspect() != arg {
+				t.Errorf("expected %s, got=%s", arg, evaluated.Inspect())
+			}
+		}(fmt.Sprint(i))
+	}
+	wg.Wait()
+
+	testNullObject(t, testEval(`args()[0]`))
+
+	evaluated = testEval(`args(1)`)
+	err, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+	if err.Message != "wrong number of arguments. got=1, want=0" {
+		t.Errorf("wrong error message. got=%q", err.Message)
+	}
+}
+
 func TestArrayLiteral(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 
@@ -321,24 +964,108 @@ func TestArrayLiteral(t *testing.T) {
 	testIntegerObject(t, array.Elements[2], 6)
 }
 
+var arrayIndexTests = []struct {
+	input    string
+	expected any
+}{
+	{"[1, 2, 3][0]", 1},
+	{"[1, 2, 3][1]", 2},
+	{"[1, 2, 3][2]", 3},
+	{"let i = 0; [1][i]", 1},
+	{"[1, 2, 3][1 + 1]", 3},
+	{"let myArray = [1, 2, 3]; myArray[2];", 3},
+	{"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];", 6},
+	{"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]", 2},
+	{"[1, 2, 3][3]", nil},
+	{"[1, 2, 3][-1]", nil},
+}
+
 func TestArrayIndexExpressions(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected any
-	}{
-		{"[1, 2, 3][0]", 1},
-		{"[1, 2, 3][1]", 2},
-		{"[1, 2, 3][2]", 3},
-		{"let i = 0; [1][i]", 1},
-		{"[1, 2, 3][1 + 1]", 3},
-		{"let myArray = [1, 2, 3]; myArray[2];", 3},
-		{"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];", 6},
-		{"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]", 2},
-		{"[1, 2, 3][3]", nil},
-		{"[1, 2, 3][-1]", nil},
+	for _, test := range arrayIndexTests {
+		evaluated := testEval(test.input)
+		integer, ok := test.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
 	}
+}
 
-	for _, test := range tests {
+func TestHashLiterals(t *testing.T) {
+	input := `let two = "two";
+	{
+		"one": 10 - 9,
+		two: 1 + 1,
+		"thr" + "ee": 6 / 2,
+		4: 4,
+		true: 5,
+		false: 6
+	}`
+	evaluated := testEval(input)
+	result, ok := evaluated.(*object.Hash)
+	if !ok {
+		t.Fatalf("expected Hash. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	expected := map[object.HashKey]int64{
+		(&object.String{Value: "one"}).HashKey():   1,
+		(&object.String{Value: "two"}).HashKey():   2,
+		(&object.String{Value: "three"}).HashKey(): 3,
+		(&object.Integer{Value: 4}).HashKey():      4,
+		object.TRUE.HashKey():                      5,
+		object.FALSE.HashKey():                     6,
+	}
+	if len(result.Pairs) != len(expected) {
+		t.Fatalf("hash has wrong number of pairs. got=%d", len(result.Pairs))
+	}
+	for expectedKey, expectedValue := range expected {
+		pair, ok := result.Pairs[expectedKey]
+		if !ok {
+			t.Errorf("no pair for given key in Pairs")
+			continue
+		}
+		testIntegerObject(t, pair.Value, expectedValue)
+	}
+}
+
+var hashOrderTests = []struct {
+	input    string
+	expected string
+}{
+	{`{"b": 1, "a": 2, 3: 3, true: 4}`, `{b: 1, a: 2, 3: 3, true: 4}`},
+	{`{"a": 1, "b": 2, "a": 3}`, `{a: 3, b: 2}`},
+	{`let h = {"z": 1}; h["y"] = 2; h["z"] = 3; h`, `{z: 3, y: 2}`},
+	{`let keys = []; for (k in {"c": 1, "a": 2, "b": 3}) { keys = push(keys, k) }; keys`, `[c, a, b]`},
+	{`let log = []; let f = fn(x) { log = push(log, x); x }; {f("k1"): f(1), f("k2"): f(2)}; log`, `[k1, 1, k2, 2]`},
+	{`try { throw("x") } catch (e) { e }`, `{message: x, line: 1, column: 7, value: x}`},
+}
+
+func TestHashOrder(t *testing.T) {
+	for _, test := range hashOrderTests {
+		evaluated := testEval(test.input)
+		if evaluated.Inspect() != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.input, test.expected, evaluated.Inspect())
+		}
+	}
+}
+
+var hashIndexTests = []struct {
+	input    string
+	expected any
+}{
+	{`{"foo": 5}["foo"]`, 5},
+	{`{"foo": 5}["bar"]`, nil},
+	{`let key = "foo"; {"foo": 5}[key]`, 5},
+	{`{}["foo"]`, nil},
+	{`{5: 5}[5]`, 5},
+	{`{true: 5}[true]`, 5},
+	{`{false: 5}[false]`, 5},
+	{`{"a": 1, "a": 2}["a"]`, 2},
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	for _, test := range hashIndexTests {
 		evaluated := testEval(test.input)
 		integer, ok := test.expected.(int)
 		if ok {
@@ -362,6 +1089,19 @@ func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	return true
 }
 
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("Expected object to be a float but got %s", obj.Inspect())
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("Expected object to be %g but got %s", expected, obj.Inspect())
+		return false
+	}
+	return true
+}
+
 func testNullObject(t *testing.T, obj object.Object) bool {
 	_, ok := obj.(*object.Null)
 	if !ok {
@@ -380,6 +1120,11 @@ func testEval(input string) object.Object {
 	return Eval(program, env)
 }
 
+func testEvalWithOptions(input string, opts Options) object.Object {
+	program := parser.New(lexer.New(input)).ParseProgram()
+	return EvalWithOptions(program, object.NewEnvironment(), opts)
+}
+
 func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 	result, ok := obj.(*object.Boolean)
 	if !ok {
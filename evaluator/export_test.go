@@ -0,0 +1,27 @@
+package evaluator
+
+import "reflect"
+
+// corpusTables are the test tables whose programs run the same way on every
+// engine. Tables that need a setting other than the defaults, such as
+// checked arithmetic, are left out.
+var corpusTables = []any{
+	integerTests, floatTests, booleanTests, bangOperatorTests, ifElseTests,
+	returnTests, errorHandlingTests, errorPositionTests, errorStackTests,
+	tailCallTests, functionApplicationTests, functionArityTests, variadicTests,
+	assignmentTests, destructuringTests, tryCatchTests, loopTests, matchTests,
+	builtinTests, arrayIndexTests, hashIndexTests, hashOrderTests,
+}
+
+// Corpus returns the programs of the evaluator tests, for the tests in
+// package evaluator_test that compare the evaluator with other engines.
+func Corpus() []string {
+	var programs []string
+	for _, table := range corpusTables {
+		tests := reflect.ValueOf(table)
+		for i := 0; i < tests.Len(); i++ {
+			programs = append(programs, tests.Index(i).FieldByName("input").String())
+		}
+	}
+	return programs
+}
@@ -0,0 +1,206 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/object"
+)
+
+// DefineMacros removes the top-level `let name = macro(...) { ... }`
+// statements from program and binds the macros in env.
+func DefineMacros(program *ast.Program, env *object.Environment) {
+	statements := program.Statements[:0]
+	for _, statement := range program.Statements {
+		let, ok := statement.(*ast.LetStatement)
+		if !ok || let.Name == nil {
+			statements = append(statements, statement)
+			continue
+		}
+		literal, ok := let.Value.(*ast.MacroLiteral)
+		if !ok {
+			statements = append(statements, statement)
+			continue
+		}
+
+		renameBindings(let.Name.Value, literal.Body)
+		env.Set(let.Name.Value, &object.Macro{
+			Name:       let.Name.Value,
+			Parameters: literal.Parameters,
+			Body:       literal.Body,
+			Env:        env,
+		})
+	}
+	program.Statements = statements
+}
+
+// ExpandMacros replaces the calls to the macros bound in env by the code
+// the macros return. The macros are called with their arguments quoted.
+// Macro calls in the code returned by a macro are not expanded.
+func ExpandMacros(program ast.Node, env *object.Environment) (ast.Node, *object.Error) {
+	var err *object.Error
+	expanded := ast.Modify(program, func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || err != nil {
+			return node
+		}
+		macro, ok := macroOf(call, env)
+		if !ok {
+			return node
+		}
+
+		var expansion ast.Node
+		if expansion, err = expandMacro(macro, call); err != nil {
+			return node
+		}
+		return expansion
+	})
+	if err != nil {
+		return nil, err
+	}
+	return expanded, nil
+}
+
+func macroOf(call *ast.CallExpression, env *object.Environment) (*object.Macro, bool) {
+	identifier, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return nil, false
+	}
+	obj, ok := env.Get(identifier.Value)
+	if !ok {
+		return nil, false
+	}
+	macro, ok := obj.(*object.Macro)
+	return macro, ok
+}
+
+func expandMacro(macro *object.Macro, call *ast.CallExpression) (ast.Node, *object.Error) {
+	if len(call.Arguments) != len(macro.Parameters) {
+		err := arityError(macro.Name, len(call.Arguments), len(macro.Parameters), 0, false)
+		err.Pos = call.Pos()
+		return nil, err
+	}
+
+	env := object.NewEnclosedEnvironment(macro.Env)
+	for i, parameter := range macro.Parameters {
+		env.Set(parameter.Value, &object.Quote{Node: call.Arguments[i]})
+	}
+
+	result := unwrapReturnValue(Eval(macro.Body, env))
+	if result == nil {
+		result = object.NULL
+	}
+	switch result := result.(type) {
+	case *object.Quote:
+		return result.Node, nil
+	case *object.Error:
+		result.AddFrame(object.Frame{Function: macro.Name, Pos: call.Pos()}, MaxStackFrames)
+		return nil, result
+	default:
+		err := newError("macro `%s` returned %s, want QUOTE", macro.Name, result.Type())
+		err.Pos = call.Pos()
+		return nil, err
+	}
+}
+
+// renameBindings gives the variables defined by the quoted code in the
+// body of the macro called name unique names, so that the code a macro
+// returns cannot capture or shadow the variables at the place it is
+// expanded. The new names contain the macro name and '@', which no
+// identifier in the source can. Code spliced in with unquote keeps its
+// names, and so do the keys of hash patterns, which name the hash entries
+// as well.
+func renameBindings(name string, body *ast.BlockStatement) {
+	renames := 0
+	ast.Inspect(body, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || !isCallTo(call, "quote") {
+			return true
+		}
+
+		names := make(map[string]string)
+		inspectQuoted(call, func(node ast.Node) {
+			for _, identifier := range boundIdentifiers(node) {
+				if _, ok := names[identifier.Value]; !ok && identifier.Value != "_" {
+					renames++
+					names[identifier.Value] = fmt.Sprintf("%s@%s.%d", identifier.Value, name, renames)
+				}
+			}
+		})
+
+		renamed := make(map[*ast.Identifier]bool)
+		inspectQuoted(call, func(node ast.Node) {
+			if identifier, ok := node.(*ast.Identifier); ok {
+				if _, ok := names[identifier.Value]; ok {
+					renamed[identifier] = true
+				}
+			}
+		})
+		for i, argument := range call.Arguments {
+			call.Arguments[i] = ast.Modify(argument, func(node ast.Node) ast.Node {
+				if identifier, ok := node.(*ast.Identifier); ok && renamed[identifier] {
+					return &ast.Identifier{Token: identifier.Token, Value: names[identifier.Value]}
+				}
+				return node
+			}).(ast.Expression)
+		}
+		return false
+	})
+}
+
+// inspectQuoted calls f for the nodes in the arguments of a quote call,
+// leaving out unquote calls and hash patterns.
+func inspectQuoted(call *ast.CallExpression, f func(ast.Node)) {
+	for _, argument := range call.Arguments {
+		ast.Inspect(argument, func(node ast.Node) bool {
+			switch node := node.(type) {
+			case nil, *ast.HashPattern:
+				return false
+			case *ast.CallExpression:
+				if isCallTo(node, "unquote") {
+					return false
+				}
+			}
+			f(node)
+			return true
+		})
+	}
+}
+
+// boundIdentifiers returns the identifiers that node binds.
+func boundIdentifiers(node ast.Node) []*ast.Identifier {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		if node.Name != nil {
+			return []*ast.Identifier{node.Name}
+		}
+	case *ast.ArrayPattern:
+		var identifiers []*ast.Identifier
+		for _, element := range node.Elements {
+			if identifier, ok := element.(*ast.Identifier); ok {
+				identifiers = append(identifiers, identifier)
+			}
+		}
+		if node.Rest != nil {
+			identifiers = append(identifiers, node.Rest)
+		}
+		return identifiers
+	case *ast.FunctionLiteral:
+		var identifiers []*ast.Identifier
+		for _, parameter := range node.Parameters {
+			if parameter.Name != nil {
+				identifiers = append(identifiers, parameter.Name)
+			}
+		}
+		if node.Rest != nil {
+			identifiers = append(identifiers, node.Rest)
+		}
+		return identifiers
+	case *ast.ForStatement:
+		return []*ast.Identifier{node.Variable}
+	case *ast.TryExpression:
+		if node.Catch != nil {
+			return []*ast.Identifier{node.Parameter}
+		}
+	}
+	return nil
+}
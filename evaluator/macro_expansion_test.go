@@ -0,0 +1,215 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"testing"
+)
+
+func TestDefineMacros(t *testing.T) {
+	input := `
+	let number = 1;
+	let function = fn(x, y) { x + y };
+	let mymacro = macro(x, y) { x + y; };
+	`
+
+	env := object.NewEnvironment()
+	program := testParseProgram(input)
+
+	DefineMacros(program, env)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("Wrong number of statements. got=%d", len(program.Statements))
+	}
+	if _, ok := env.Get("number"); ok {
+		t.Fatalf("number should not be defined")
+	}
+	if _, ok := env.Get("function"); ok {
+		t.Fatalf("function should not be defined")
+	}
+
+	obj, ok := env.Get("mymacro")
+	if !ok {
+		t.Fatalf("macro not in environment.")
+	}
+	macro, ok := obj.(*object.Macro)
+	if !ok {
+		t.Fatalf("object is not Macro. got=%T (%+v)", obj, obj)
+	}
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("Wrong number of macro parameters. got=%d", len(macro.Parameters))
+	}
+	if macro.Parameters[0].String() != "x" {
+		t.Fatalf("parameter is not 'x'. got=%q", macro.Parameters[0])
+	}
+	if macro.Parameters[1].String() != "y" {
+		t.Fatalf("parameter is not 'y'. got=%q", macro.Parameters[1])
+	}
+
+	expectedBody := "(x + y)"
+	if macro.Body.String() != expectedBody {
+		t.Fatalf("body is not %q. got=%q", expectedBody, macro.Body.String())
+	}
+}
+
+func TestExpandMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`
+			let infixExpression = macro() { quote(1 + 2); };
+
+			infixExpression();
+			`,
+			`(1 + 2)`,
+		},
+		{
+			`
+			let reverse = macro(a, b) { quote(unquote(b) - unquote(a)); };
+
+			reverse(2 + 2, 10 - 5);
+			`,
+			`(10 - 5) - (2 + 2)`,
+		},
+		{
+			`
+			let unless = macro(condition, consequence, alternative) {
+				quote(if (!(unquote(condition))) {
+					unquote(consequence);
+				} else {
+					unquote(alternative);
+				});
+			};
+
+			unless(10 > 5, puts("not greater"), puts("greater"));
+			`,
+			`if (!(10 > 5)) { puts("not greater") } else { puts("greater") }`,
+		},
+		{
+			`
+			let twice = macro(x) { quote(unquote(x) + unquote(x)); };
+
+			let f = fn() { twice(g()) };
+			`,
+			`let f = fn() { g() + g() };`,
+		},
+	}
+
+	for _, tt := range tests {
+		expected := testParseProgram(tt.expected)
+		program := testParseProgram(tt.input)
+
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		expanded, err := ExpandMacros(program, env)
+		if err != nil {
+			t.Fatalf("expansion failed: %s", err.Inspect())
+		}
+
+		if expanded.String() != expected.String() {
+			t.Errorf("not equal. want=%q, got=%q", expected.String(), expanded.String())
+		}
+	}
+}
+
+func TestMacroRenaming(t *testing.T) {
+	input := `
+	let swap = macro(a, b) { quote(fn() { let tmp = unquote(a); [unquote(b), tmp] }()) };
+	let keep = macro(x) { quote(fn(tmp) { tmp }(unquote(x))) };
+
+	swap(1, 2);
+	keep(3);
+	`
+
+	// The renamed variables cannot be written in source code, so the
+	// expansion is compared as text.
+	expected := "fn()let tmp@swap.1 = 1;[2, tmp@swap.1]()fn(tmp@keep.1)tmp@keep.1(3)"
+	for i := 0; i < 2; i++ {
+		program := testParseProgram(input)
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		expanded, err := ExpandMacros(program, env)
+		if err != nil {
+			t.Fatalf("expansion failed: %s", err.Inspect())
+		}
+		if expanded.String() != expected {
+			t.Errorf("wrong expansion. want=%q, got=%q", expected, expanded.String())
+		}
+	}
+}
+
+func TestExpandedMacrosEvaluate(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let unless = macro(c, a, b) { quote(if (!(unquote(c))) { unquote(a) } else { unquote(b) }) }; unless(1 > 2, "a", "b")`, "a"},
+		{`let swap = macro(a, b) { quote(fn() { let tmp = unquote(a); [unquote(b), tmp] }()) }; let tmp = 1; swap(2, tmp)`, "[1, 2]"},
+		{`let guard = macro(body, fallback) { quote(try { unquote(body) } catch (e) { unquote(fallback) }) }; let e = "outer"; guard(throw("x"), e)`, "outer"},
+		{`let m = macro(x) { quote(fn(item) { [item, unquote(x)] }) }; let item = 5; m(item)(1)`, "[1, 5]"},
+		{`let double = macro(x) { quote(unquote(x) * 2) }; let f = fn(n) { if (n == 0) { 0 } else { double(f(n - 1)) + 1 } }; f(3)`, "7"},
+		{`let inner = macro() { quote(1) }; let outer = macro(x) { quote(unquote(x) + 1) }; outer(inner())`, "2"},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		expanded, err := ExpandMacros(program, env)
+		if err != nil {
+			t.Fatalf("%s: expansion failed: %s", tt.input, err.Inspect())
+		}
+
+		evaluated := Eval(expanded, object.NewEnvironment())
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: expected %s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestExpandMacrosErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		stack    []string
+	}{
+		{"let m = macro(x) { x };\nm(1, 2)", "Error at 2:1: wrong number of arguments to `m`. got=2, want=1", nil},
+		{"let m = macro() { 1 };\nm()", "Error at 2:1: macro `m` returned INTEGER, want QUOTE", nil},
+		{"let m = macro() { let x = 1; };\nm()", "Error at 2:1: macro `m` returned NULL, want QUOTE", nil},
+		{"let m = macro() { 1 + true };\nm()", "Error at 1:19: type mismatch: INTEGER + BOOLEAN", []string{"in `m` called at 2:1"}},
+		{"let m = macro() { quote(unquote(missing)) };\nm()", "Error at 1:33: identifier not found: missing", []string{"in `m` called at 2:1"}},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		_, err := ExpandMacros(program, env)
+		if err == nil {
+			t.Errorf("%s: expected error, got none", tt.input)
+			continue
+		}
+		if err.Inspect() != tt.expected {
+			t.Errorf("%s: wrong error. expected=%q, got=%q", tt.input, tt.expected, err.Inspect())
+		}
+		if len(err.Stack) != len(tt.stack) {
+			t.Errorf("%s: wrong stack depth. expected=%d, got=%d", tt.input, len(tt.stack), len(err.Stack))
+			continue
+		}
+		for i, frame := range err.Stack {
+			if frame.String() != tt.stack[i] {
+				t.Errorf("%s: wrong frame %d. expected=%q, got=%q", tt.input, i, tt.stack[i], frame.String())
+			}
+		}
+	}
+}
+
+func testParseProgram(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
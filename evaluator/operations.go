@@ -0,0 +1,71 @@
+package evaluator
+
+import "monkey/object"
+
+// The functions in this file expose the semantics of Monkey's operators to
+// other execution engines, such as the virtual machine, so that they agree
+// with the evaluator on results and error messages.
+
+// Infix applies a binary operator such as "+" or "<=". With checked set,
+// integer overflow is an error, as with Options.CheckedArithmetic.
+func Infix(operator string, left, right object.Object, checked bool) object.Object {
+	return evalInfixExpression(operator, left, right, checked)
+}
+
+// Prefix applies the unary operator "!" or "-". With checked set, negating
+// the smallest integer is an error.
+func Prefix(operator string, right object.Object, checked bool) object.Object {
+	return evalPrefixExpression(operator, right, checked)
+}
+
+// Index looks up index in an array or hash.
+func Index(container, index object.Object) object.Object {
+	return evalIndexExpression(container, index)
+}
+
+// SetIndex stores value under index in an array or hash and returns value.
+func SetIndex(container, index, value object.Object) object.Object {
+	return setIndex(container, index, value)
+}
+
+// IsTruthy reports whether obj counts as true in a condition.
+func IsTruthy(obj object.Object) bool {
+	return isTruthy(obj)
+}
+
+// Equal reports whether a match pattern value equals the matched value.
+func Equal(left, right object.Object) bool {
+	return objectsEqual(left, right)
+}
+
+// HashKey returns the key under which obj is stored in a hash.
+func HashKey(obj object.Object) (object.HashKey, *object.Error) {
+	return hashKeyOf(obj)
+}
+
+// IterationItems returns the values a for loop over obj visits.
+func IterationItems(obj object.Object) ([]object.Object, *object.Error) {
+	return iterationItems(obj)
+}
+
+// DestructureArray returns the values bound by an array pattern with the
+// given number of elements, followed by the rest array when rest is set.
+func DestructureArray(value object.Object, elements int, rest bool, pattern string) ([]object.Object, *object.Error) {
+	return destructureArray(value, elements, rest, pattern)
+}
+
+// DestructureHash returns the values bound by a hash pattern with keys.
+func DestructureHash(value object.Object, keys []string, pattern string) ([]object.Object, *object.Error) {
+	return destructureHash(value, keys, pattern)
+}
+
+// CaughtError returns the value a catch block binds for err.
+func CaughtError(err *object.Error) *object.Hash {
+	return caughtError(err)
+}
+
+// ArityError reports a call with the wrong number of arguments to the
+// function called name, which may be empty for anonymous functions.
+func ArityError(name string, got, parameters, defaults int, rest bool) *object.Error {
+	return arityError(name, got, parameters, defaults, rest)
+}
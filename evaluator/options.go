@@ -0,0 +1,44 @@
+package evaluator
+
+import (
+	"context"
+	"monkey/ast"
+	"monkey/object"
+)
+
+// Options configure a single evaluation. The zero value evaluates without
+// a deadline or step budget, with the default call depth limit and with
+// integer arithmetic that wraps around.
+type Options struct {
+	// Context stops the evaluation once it is done. Nil means never.
+	Context context.Context
+	// Budget, when positive, is the number of nodes that may be evaluated.
+	Budget int64
+	// MaxCallDepth limits how deeply Monkey function calls may nest before
+	// evaluation stops with an error. Zero means DefaultMaxCallDepth and a
+	// negative depth removes the limit.
+	MaxCallDepth int
+	// CheckedArithmetic makes integer operations report an error on int64
+	// overflow instead of silently wrapping around.
+	CheckedArithmetic bool
+	// Args are the script arguments returned by the `args` builtin.
+	Args []string
+}
+
+// CallDepthLimit returns the call depth limit set by o, or zero when calls
+// may nest without limit.
+func (o Options) CallDepthLimit() int {
+	switch {
+	case o.MaxCallDepth == 0:
+		return DefaultMaxCallDepth
+	case o.MaxCallDepth < 0:
+		return 0
+	}
+	return o.MaxCallDepth
+}
+
+// EvalWithOptions evaluates node like Eval, with the settings in opts.
+func EvalWithOptions(node ast.Node, env *object.Environment, opts Options) object.Object {
+	ev := &evaluation{options: opts}
+	return ev.eval(node, env)
+}
@@ -0,0 +1,103 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+	"monkey/token"
+	"strconv"
+)
+
+// quote returns the code of its argument unevaluated, except for the
+// calls to unquote in it, which are replaced by the code for the values of
+// their arguments.
+func (ev *evaluation) quote(call *ast.CallExpression, env *object.Environment) object.Object {
+	if len(call.Arguments) != 1 {
+		return newError("wrong number of arguments to `quote`. got=%d, want=1", len(call.Arguments))
+	}
+	node, err := ev.evalUnquoteCalls(call.Arguments[0], env)
+	if err != nil {
+		return err
+	}
+	return &object.Quote{Node: node}
+}
+
+// evalUnquoteCalls works on a copy of quoted, so that a quote evaluated
+// again sees its unquote calls again.
+func (ev *evaluation) evalUnquoteCalls(quoted ast.Node, env *object.Environment) (ast.Node, *object.Error) {
+	var err *object.Error
+	node := ast.Modify(ast.Copy(quoted), func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || err != nil || !isSpecialCall(call, "unquote", env) {
+			return node
+		}
+		if len(call.Arguments) != 1 {
+			err = newError("wrong number of arguments to `unquote`. got=%d, want=1", len(call.Arguments))
+			err.Pos = call.Pos()
+			return node
+		}
+
+		unquoted := ev.eval(call.Arguments[0], env)
+		if e, ok := unquoted.(*object.Error); ok {
+			err = e
+			return node
+		}
+		var converted ast.Node
+		if converted, err = toASTNode(unquoted, call.Pos()); err != nil {
+			return node
+		}
+		return converted
+	})
+	return node, err
+}
+
+// toASTNode returns the code for a value, placed at pos.
+func toASTNode(obj object.Object, pos token.Position) (ast.Node, *object.Error) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		literal := strconv.FormatInt(obj.Value, 10)
+		return &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: literal, Pos: pos}, Value: obj.Value}, nil
+	case *object.Float:
+		return &ast.FloatLiteral{Token: token.Token{Type: token.FLOAT, Literal: obj.Inspect(), Pos: pos}, Value: obj.Value}, nil
+	case *object.String:
+		return &ast.StringLiteral{Token: token.Token{Type: token.STRING, Literal: obj.Value, Pos: pos}, Value: obj.Value}, nil
+	case *object.Boolean:
+		t := token.Token{Type: token.FALSE, Literal: "false", Pos: pos}
+		if obj.Value {
+			t = token.Token{Type: token.TRUE, Literal: "true", Pos: pos}
+		}
+		return &ast.Boolean{Token: t, Value: obj.Value}, nil
+	case *object.Array:
+		array := &ast.ArrayLiteral{Token: token.Token{Type: token.LBRACKET, Literal: "[", Pos: pos}}
+		for _, element := range obj.Elements {
+			node, err := toASTNode(element, pos)
+			if err != nil {
+				return nil, err
+			}
+			array.Elements = append(array.Elements, node.(ast.Expression))
+		}
+		return array, nil
+	case *object.Quote:
+		return ast.Copy(obj.Node), nil
+	default:
+		err := newError("cannot unquote %s", obj.Type())
+		err.Pos = pos
+		return nil, err
+	}
+}
+
+// isCallTo reports whether call calls the function named name.
+func isCallTo(call *ast.CallExpression, name string) bool {
+	identifier, ok := call.Function.(*ast.Identifier)
+	return ok && identifier.Value == name
+}
+
+// isSpecialCall reports whether call calls quote or unquote, given as
+// name. Programs may bind these names like any other, and calls to them
+// are then ordinary calls.
+func isSpecialCall(call *ast.CallExpression, name string, env *object.Environment) bool {
+	if !isCallTo(call, name) {
+		return false
+	}
+	_, bound := env.Get(name)
+	return !bound
+}
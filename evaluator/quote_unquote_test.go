@@ -0,0 +1,84 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"testing"
+)
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(5)`, `5`},
+		{`quote(5 + 8)`, `(5 + 8)`},
+		{`quote(foobar)`, `foobar`},
+		{`quote(foobar + barfoo)`, `(foobar + barfoo)`},
+	}
+
+	for _, tt := range tests {
+		testQuote(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestQuoteUnquote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(unquote(4))`, `4`},
+		{`quote(unquote(4 + 4))`, `8`},
+		{`quote(8 + unquote(4 + 4))`, `(8 + 8)`},
+		{`quote(unquote(4 + 4) + 8)`, `(8 + 8)`},
+		{`let foobar = 8; quote(foobar)`, `foobar`},
+		{`let foobar = 8; quote(unquote(foobar))`, `8`},
+		{`quote(unquote(true))`, `true`},
+		{`quote(unquote(true == false))`, `false`},
+		{`quote(unquote(quote(4 + 4)))`, `(4 + 4)`},
+		{`let quotedInfixExpression = quote(4 + 4); quote(unquote(4 + 4) + unquote(quotedInfixExpression))`, `(8 + (4 + 4))`},
+		{`quote(unquote(1.5) + unquote("s"))`, `(1.5 + s)`},
+		{`quote(unquote([1, -2]))`, `[1, -2]`},
+		{`let f = fn(n) { quote(unquote(n) * 2) }; f(3); f(4)`, `(4 * 2)`},
+		{`let unquote = fn(x) { x }; quote(unquote(1 + 2))`, `unquote((1 + 2))`},
+	}
+
+	for _, tt := range tests {
+		testQuote(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestQuoteErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(1, 2)`, "Error at 1:1: wrong number of arguments to `quote`. got=2, want=1"},
+		{`quote(unquote())`, "Error at 1:7: wrong number of arguments to `unquote`. got=0, want=1"},
+		{`quote(unquote(missing))`, "Error at 1:15: identifier not found: missing"},
+		{`quote(unquote({}))`, "Error at 1:7: cannot unquote HASH"},
+		{`unquote(1)`, "Error at 1:1: identifier not found: unquote"},
+		{`macro(x) { x }`, "Error at 1:1: macro literals must be bound with a top-level let statement"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: expected %q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func testQuote(t *testing.T, evaluated object.Object, expected string) {
+	t.Helper()
+
+	quote, ok := evaluated.(*object.Quote)
+	if !ok {
+		t.Fatalf("expected *object.Quote. got=%T (%+v)", evaluated, evaluated)
+	}
+	if quote.Node == nil {
+		t.Fatalf("quote.Node is nil")
+	}
+	if quote.Node.String() != expected {
+		t.Errorf("not equal. got=%q, want=%q", quote.Node.String(), expected)
+	}
+}
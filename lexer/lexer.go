@@ -1,7 +1,9 @@
 package lexer
 
 import (
+	"fmt"
 	"monkey/token"
+	"strings"
 )
 
 type Lexer struct {
@@ -9,6 +11,10 @@ type Lexer struct {
 	position     int
 	readPosition int
 	ch           byte
+	line         int
+	column       int
+
+	emitComments bool
 }
 
 func newToken(tokenType token.TokenType, ch byte) token.Token {
@@ -16,9 +22,22 @@ func newToken(tokenType token.TokenType, ch byte) token.Token {
 }
 
 func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
+	for {
+		l.skipWhitespace()
+
+		start := l.currentPosition()
+		tok := l.readToken()
+		tok.Pos = start
+		tok.End = l.currentPosition()
+		if tok.Type == token.COMMENT && !l.emitComments {
+			continue
+		}
+		return tok
+	}
+}
 
-	l.skipWhitespace()
+func (l *Lexer) readToken() token.Token {
+	var tok token.Token
 
 	switch l.ch {
 	case '=':
@@ -26,11 +45,15 @@ func (l *Lexer) NextToken() token.Token {
 			l.readChar()
 			tok.Type = token.EQ
 			tok.Literal = "=="
+		} else if l.peekChar() == '>' {
+			l.readChar()
+			tok.Type = token.FAT_ARROW
+			tok.Literal = "=>"
 		} else {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		tok = l.readOperator(token.PLUS, token.PLUS_ASSIGN)
 	case '(':
 		tok = newToken(token.LPAREN, l.ch)
 	case ')':
@@ -47,6 +70,17 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.COMMA, l.ch)
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
+	case ':':
+		tok = newToken(token.COLON, l.ch)
+	case '.':
+		if l.peekChar() == '.' && l.peekCharAt(1) == '.' {
+			l.readChar()
+			l.readChar()
+			tok.Type = token.ELLIPSIS
+			tok.Literal = "..."
+		} else {
+			tok = illegal(fmt.Sprintf("illegal character %q", l.ch))
+		}
 	case '!':
 		if l.peekChar() == '=' {
 			l.readChar()
@@ -56,18 +90,52 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.BANG, l.ch)
 		}
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		tok = l.readOperator(token.ASTERISK, token.ASTERISK_ASSIGN)
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		if l.peekChar() == '/' || l.peekChar() == '*' {
+			return l.readComment()
+		}
+		tok = l.readOperator(token.SLASH, token.SLASH_ASSIGN)
+	case '%':
+		tok = newToken(token.PERCENT, l.ch)
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok.Type = token.LT_EQ
+			tok.Literal = "<="
+		} else {
+			tok = newToken(token.LT, l.ch)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok.Type = token.GT_EQ
+			tok.Literal = ">="
+		} else {
+			tok = newToken(token.GT, l.ch)
+		}
+	case '&':
+		if l.peekChar() == '&' {
+			l.readChar()
+			tok.Type = token.AND
+			tok.Literal = "&&"
+		} else {
+			tok = illegal(fmt.Sprintf("illegal character %q", l.ch))
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			l.readChar()
+			tok.Type = token.OR
+			tok.Literal = "||"
+		} else {
+			tok = illegal(fmt.Sprintf("illegal character %q", l.ch))
+		}
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		tok = l.readOperator(token.MINUS, token.MINUS_ASSIGN)
 	case '"':
-		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		tok = l.readString()
+	case '`':
+		tok = l.readRawString()
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
@@ -77,32 +145,83 @@ func (l *Lexer) NextToken() token.Token {
 			tok.Type = LookupIdent(tok.Literal)
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Literal = l.readNumber()
-			tok.Type = token.INT
+			tok.Literal, tok.Type = l.readNumber()
 			return tok
 		} else {
-			tok = newToken(token.ILLEGAL, l.ch)
+			tok = illegal(fmt.Sprintf("illegal character %q", l.ch))
 		}
 	}
 	l.readChar()
 	return tok
 }
 
-func (l *Lexer) readNumber() string {
+// readOperator reads an operator that has a compound assignment form, such
+// as `+` and `+=`.
+func (l *Lexer) readOperator(plain, assign token.TokenType) token.Token {
+	if l.peekChar() == '=' {
+		ch := l.ch
+		l.readChar()
+		return token.Token{Type: assign, Literal: string(ch) + "="}
+	}
+	return newToken(plain, l.ch)
+}
+
+func (l *Lexer) readNumber() (string, token.TokenType) {
 	start := l.position
+	var tokenType token.TokenType = token.INT
+	l.readDigits()
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
+		l.readChar()
+		l.readDigits()
+	}
+	if l.ch == 'e' || l.ch == 'E' {
+		sign := l.peekChar() == '+' || l.peekChar() == '-'
+		if isDigit(l.peekChar()) || sign && isDigit(l.peekCharAt(1)) {
+			tokenType = token.FLOAT
+			l.readChar()
+			if sign {
+				l.readChar()
+			}
+			l.readDigits()
+		}
+	}
+	return l.input[start:l.position], tokenType
+}
+
+func (l *Lexer) readDigits() {
 	for isDigit(l.ch) {
 		l.readChar()
 	}
-	return l.input[start:l.position]
 }
 
 func New(input string) *Lexer {
-	lexer := &Lexer{input: input}
+	lexer := &Lexer{input: input, line: 1}
 	lexer.readChar()
 	return lexer
 }
 
+// NewWithComments returns a lexer that emits COMMENT tokens instead of
+// skipping comments. The parser collects them in ast.Program.Comments.
+func NewWithComments(input string) *Lexer {
+	lexer := New(input)
+	lexer.emitComments = true
+	return lexer
+}
+
+func (l *Lexer) Input() string {
+	return l.input
+}
+
 func (l *Lexer) readChar() {
+	if l.readPosition > len(l.input) {
+		return
+	}
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -112,22 +231,135 @@ func (l *Lexer) readChar() {
 	l.readPosition++
 }
 
-func (l *Lexer) readString() string {
+func (l *Lexer) currentPosition() token.Position {
+	return token.Position{Offset: l.position, Line: l.line, Column: l.column}
+}
+
+func (l *Lexer) readComment() token.Token {
+	start := l.position
+	if l.peekChar() == '/' {
+		for l.ch != '\n' && l.ch != 0 {
+			l.readChar()
+		}
+		return token.Token{Type: token.COMMENT, Literal: l.input[start:l.position]}
+	}
+
+	l.readChar()
+	l.readChar()
+	for !(l.ch == '*' && l.peekChar() == '/') {
+		if l.ch == 0 {
+			return illegal("unterminated comment")
+		}
+		l.readChar()
+	}
+	l.readChar()
+	l.readChar()
+	return token.Token{Type: token.COMMENT, Literal: l.input[start:l.position]}
+}
+
+// illegal returns an ILLEGAL token whose literal describes the problem.
+func illegal(message string) token.Token {
+	return token.Token{Type: token.ILLEGAL, Literal: message}
+}
+
+func (l *Lexer) readString() token.Token {
+	var out strings.Builder
+	var problem string
+
+	for {
+		l.readChar()
+		switch l.ch {
+		case '"':
+			if problem != "" {
+				return illegal(problem)
+			}
+			return token.Token{Type: token.STRING, Literal: out.String()}
+		case 0, '\n':
+			return illegal("unterminated string literal")
+		case '\\':
+			if err := l.readEscape(&out); err != "" && problem == "" {
+				problem = err
+			}
+		default:
+			out.WriteByte(l.ch)
+		}
+	}
+}
+
+var escapes = map[byte]byte{
+	'n':  '\n',
+	't':  '\t',
+	'r':  '\r',
+	'\\': '\\',
+	'"':  '"',
+}
+
+// readEscape decodes the escape sequence starting at the current '\\' and
+// returns a description of the problem if it is invalid.
+func (l *Lexer) readEscape(out *strings.Builder) string {
+	next := l.peekChar()
+	if decoded, ok := escapes[next]; ok {
+		l.readChar()
+		out.WriteByte(decoded)
+		return ""
+	}
+	if next != 'u' {
+		if next == 0 || next == '\n' {
+			return ""
+		}
+		l.readChar()
+		return fmt.Sprintf("unknown escape sequence \\%c", next)
+	}
+
+	l.readChar()
+	var value rune
+	for i := 0; i < 4; i++ {
+		digit, ok := hexValue(l.peekChar())
+		if !ok {
+			return "invalid unicode escape sequence"
+		}
+		l.readChar()
+		value = value*16 + digit
+	}
+	out.WriteRune(value)
+	return ""
+}
+
+func hexValue(ch byte) (rune, bool) {
+	switch {
+	case ch >= '0' && ch <= '9':
+		return rune(ch - '0'), true
+	case ch >= 'a' && ch <= 'f':
+		return rune(ch-'a') + 10, true
+	case ch >= 'A' && ch <= 'F':
+		return rune(ch-'A') + 10, true
+	default:
+		return 0, false
+	}
+}
+
+func (l *Lexer) readRawString() token.Token {
 	start := l.position + 1
 	for {
 		l.readChar()
-		if l.ch == '"' || l.ch == 0 {
-			break
+		switch l.ch {
+		case '`':
+			return token.Token{Type: token.STRING, Literal: l.input[start:l.position]}
+		case 0:
+			return illegal("unterminated raw string literal")
 		}
 	}
-	return l.input[start:l.position]
 }
 
 func (l *Lexer) peekChar() byte {
-	if l.readPosition >= len(l.input) {
+	return l.peekCharAt(0)
+}
+
+func (l *Lexer) peekCharAt(offset int) byte {
+	if l.readPosition+offset >= len(l.input) {
 		return 0
 	}
-	return l.input[l.readPosition]
+	return l.input[l.readPosition+offset]
 }
 
 func (l *Lexer) readIdentifier() string {
@@ -147,13 +379,23 @@ func isDigit(ch byte) bool {
 }
 
 var keywords = map[string]token.TokenType{
-	"let":    token.LET,
-	"fn":     token.FUNCTION,
-	"true":   token.TRUE,
-	"false":  token.FALSE,
-	"if":     token.IF,
-	"else":   token.ELSE,
-	"return": token.RETURN,
+	"let":      token.LET,
+	"fn":       token.FUNCTION,
+	"true":     token.TRUE,
+	"false":    token.FALSE,
+	"if":       token.IF,
+	"else":     token.ELSE,
+	"return":   token.RETURN,
+	"while":    token.WHILE,
+	"for":      token.FOR,
+	"in":       token.IN,
+	"break":    token.BREAK,
+	"continue": token.CONTINUE,
+	"match":    token.MATCH,
+	"try":      token.TRY,
+	"catch":    token.CATCH,
+	"finally":  token.FINALLY,
+	"macro":    token.MACRO,
 }
 
 func LookupIdent(ident string) token.TokenType {
@@ -12,7 +12,7 @@ func TestNextToken(t *testing.T) {
 		x + y;
 	};
 	let result = add(five, ten);
-	!-/*5;
+	!-/ *5;
 	5 < 10 > 5;
 
 	if (5 < 10) {
@@ -26,6 +26,7 @@ func TestNextToken(t *testing.T) {
 	"foobar"
 	"foo bar"
 	[1, 2];
+	{"foo": "bar"}
 	`
 
 	tests := []struct {
@@ -113,6 +114,11 @@ func TestNextToken(t *testing.T) {
 		{token.INT, "2"},
 		{token.RBRACKET, "]"},
 		{token.SEMICOLON, ";"},
+		{token.LBRACE, "{"},
+		{token.STRING, "foo"},
+		{token.COLON, ":"},
+		{token.STRING, "bar"},
+		{token.RBRACE, "}"},
 		{token.EOF, ""},
 	}
 
@@ -128,3 +134,273 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n  \"ab\" + y\n"
+
+	tests := []struct {
+		expectedType token.TokenType
+		expectedPos  token.Position
+		expectedEnd  token.Position
+	}{
+		{token.LET, token.Position{Offset: 0, Line: 1, Column: 1}, token.Position{Offset: 3, Line: 1, Column: 4}},
+		{token.IDENTIFIER, token.Position{Offset: 4, Line: 1, Column: 5}, token.Position{Offset: 5, Line: 1, Column: 6}},
+		{token.ASSIGN, token.Position{Offset: 6, Line: 1, Column: 7}, token.Position{Offset: 7, Line: 1, Column: 8}},
+		{token.INT, token.Position{Offset: 8, Line: 1, Column: 9}, token.Position{Offset: 9, Line: 1, Column: 10}},
+		{token.SEMICOLON, token.Position{Offset: 9, Line: 1, Column: 10}, token.Position{Offset: 10, Line: 1, Column: 11}},
+		{token.STRING, token.Position{Offset: 13, Line: 2, Column: 3}, token.Position{Offset: 17, Line: 2, Column: 7}},
+		{token.PLUS, token.Position{Offset: 18, Line: 2, Column: 8}, token.Position{Offset: 19, Line: 2, Column: 9}},
+		{token.IDENTIFIER, token.Position{Offset: 20, Line: 2, Column: 10}, token.Position{Offset: 21, Line: 2, Column: 11}},
+		{token.EOF, token.Position{Offset: 22, Line: 3, Column: 1}, token.Position{Offset: 22, Line: 3, Column: 1}},
+	}
+
+	l := New(input)
+
+	for i, test := range tests {
+		tok := l.NextToken()
+		if tok.Type != test.expectedType {
+			t.Fatalf("Test %d: Expected type %s, got %s", i, test.expectedType, tok.Type)
+		}
+		if tok.Pos != test.expectedPos {
+			t.Errorf("Test %d: Expected pos %+v, got %+v", i, test.expectedPos, tok.Pos)
+		}
+		if tok.End != test.expectedEnd {
+			t.Errorf("Test %d: Expected end %+v, got %+v", i, test.expectedEnd, tok.End)
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{"42", token.INT, "42"},
+		{"3.14", token.FLOAT, "3.14"},
+		{"0.5", token.FLOAT, "0.5"},
+		{"1e9", token.FLOAT, "1e9"},
+		{"1e-9", token.FLOAT, "1e-9"},
+		{"2.5E+3", token.FLOAT, "2.5E+3"},
+		{"1.", token.INT, "1"},
+		{"1e", token.INT, "1"},
+		{"1e+", token.INT, "1"},
+	}
+
+	for i, test := range tests {
+		l := New(test.input)
+		tok := l.NextToken()
+		if tok.Type != test.expectedType {
+			t.Errorf("Test %d: Expected type %s, got %s", i, test.expectedType, tok.Type)
+		}
+		if tok.Literal != test.expectedLiteral {
+			t.Errorf("Test %d: Expected literal %s, got %s", i, test.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading comment
+	let x = 5; // trailing
+	/* block
+	   comment */ x / 2
+	/* unterminated`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.COMMENT, "// leading comment"},
+		{token.LET, "let"},
+		{token.IDENTIFIER, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.COMMENT, "// trailing"},
+		{token.COMMENT, "/* block\n\t   comment */"},
+		{token.IDENTIFIER, "x"},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.ILLEGAL, "unterminated comment"},
+		{token.EOF, ""},
+	}
+
+	l := NewWithComments(input)
+	for i, test := range tests {
+		tok := l.NextToken()
+		if tok.Type != test.expectedType {
+			t.Errorf("Test %d: Expected type %s, got %s", i, test.expectedType, tok.Type)
+		}
+		if tok.Literal != test.expectedLiteral {
+			t.Errorf("Test %d: Expected literal %q, got %q", i, test.expectedLiteral, tok.Literal)
+		}
+	}
+
+	l = New(input)
+	for i, test := range tests {
+		if test.expectedType == token.COMMENT {
+			continue
+		}
+		tok := l.NextToken()
+		if tok.Type != test.expectedType {
+			t.Errorf("Test %d: Expected type %s, got %s", i, test.expectedType, tok.Type)
+		}
+	}
+}
+
+func TestStrings(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{`"plain"`, token.STRING, "plain"},
+		{`"a\"b"`, token.STRING, `a"b`},
+		{`"line\nbreak\ttab"`, token.STRING, "line\nbreak\ttab"},
+		{`"back\\slash"`, token.STRING, `back\slash`},
+		{`"\u00e9t\u00E9"`, token.STRING, "été"},
+		{`"été"`, token.STRING, "été"},
+		{"`raw\n\\n string`", token.STRING, "raw\n\\n string"},
+		{`"unterminated`, token.ILLEGAL, "unterminated string literal"},
+		{"\"new\nline\"", token.ILLEGAL, "unterminated string literal"},
+		{"`unterminated", token.ILLEGAL, "unterminated raw string literal"},
+		{`"bad \q escape"`, token.ILLEGAL, `unknown escape sequence \q`},
+		{`"\u12"`, token.ILLEGAL, "invalid unicode escape sequence"},
+		{`@`, token.ILLEGAL, "illegal character '@'"},
+	}
+
+	for i, test := range tests {
+		l := New(test.input)
+		tok := l.NextToken()
+		if tok.Type != test.expectedType {
+			t.Errorf("Test %d: Expected type %s, got %s", i, test.expectedType, tok.Type)
+		}
+		if tok.Literal != test.expectedLiteral {
+			t.Errorf("Test %d: Expected literal %q, got %q", i, test.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestTokensAfterBadString(t *testing.T) {
+	l := New(`"a\qb" + 1`)
+
+	expected := []token.TokenType{token.ILLEGAL, token.PLUS, token.INT, token.EOF}
+	for i, tokenType := range expected {
+		tok := l.NextToken()
+		if tok.Type != tokenType {
+			t.Errorf("Test %d: Expected type %s, got %s", i, tokenType, tok.Type)
+		}
+	}
+}
+
+func TestOperators(t *testing.T) {
+	input := `a <= b >= c % d && e || f & g | h ...i . += -= *= /= =>`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENTIFIER, "a"},
+		{token.LT_EQ, "<="},
+		{token.IDENTIFIER, "b"},
+		{token.GT_EQ, ">="},
+		{token.IDENTIFIER, "c"},
+		{token.PERCENT, "%"},
+		{token.IDENTIFIER, "d"},
+		{token.AND, "&&"},
+		{token.IDENTIFIER, "e"},
+		{token.OR, "||"},
+		{token.IDENTIFIER, "f"},
+		{token.ILLEGAL, "illegal character '&'"},
+		{token.IDENTIFIER, "g"},
+		{token.ILLEGAL, "illegal character '|'"},
+		{token.IDENTIFIER, "h"},
+		{token.ELLIPSIS, "..."},
+		{token.IDENTIFIER, "i"},
+		{token.ILLEGAL, "illegal character '.'"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.MINUS_ASSIGN, "-="},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.SLASH_ASSIGN, "/="},
+		{token.FAT_ARROW, "=>"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, test := range tests {
+		tok := l.NextToken()
+		if tok.Type != test.expectedType {
+			t.Errorf("Test %d: Expected type %s, got %s", i, test.expectedType, tok.Type)
+		}
+		if tok.Literal != test.expectedLiteral {
+			t.Errorf("Test %d: Expected literal %q, got %q", i, test.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestMatchKeyword(t *testing.T) {
+	input := `match (x) { _ => 1 }`
+
+	expected := []token.TokenType{
+		token.MATCH, token.LPAREN, token.IDENTIFIER, token.RPAREN, token.LBRACE,
+		token.IDENTIFIER, token.FAT_ARROW, token.INT, token.RBRACE, token.EOF,
+	}
+
+	l := New(input)
+	for i, tokenType := range expected {
+		tok := l.NextToken()
+		if tok.Type != tokenType {
+			t.Errorf("Test %d: Expected type %s, got %s", i, tokenType, tok.Type)
+		}
+	}
+}
+
+func TestTryKeywords(t *testing.T) {
+	input := `try catch finally throw`
+
+	expected := []token.TokenType{
+		token.TRY, token.CATCH, token.FINALLY, token.IDENTIFIER, token.EOF,
+	}
+
+	l := New(input)
+	for i, tokenType := range expected {
+		tok := l.NextToken()
+		if tok.Type != tokenType {
+			t.Errorf("Test %d: Expected type %s, got %s", i, tokenType, tok.Type)
+		}
+	}
+}
+
+func TestLoopKeywords(t *testing.T) {
+	input := `while for in break continue inner`
+
+	expected := []token.TokenType{
+		token.WHILE, token.FOR, token.IN, token.BREAK, token.CONTINUE, token.IDENTIFIER, token.EOF,
+	}
+
+	l := New(input)
+	for i, tokenType := range expected {
+		tok := l.NextToken()
+		if tok.Type != tokenType {
+			t.Errorf("Test %d: Expected type %s, got %s", i, tokenType, tok.Type)
+		}
+	}
+}
+
+func TestMacroKeyword(t *testing.T) {
+	input := `macro(x, y) { x + y; };`
+
+	expected := []token.TokenType{
+		token.MACRO, token.LPAREN, token.IDENTIFIER, token.COMMA, token.IDENTIFIER, token.RPAREN,
+		token.LBRACE, token.IDENTIFIER, token.PLUS, token.IDENTIFIER, token.SEMICOLON, token.RBRACE,
+		token.SEMICOLON, token.EOF,
+	}
+
+	l := New(input)
+	for i, tokenType := range expected {
+		tok := l.NextToken()
+		if tok.Type != tokenType {
+			t.Errorf("Test %d: Expected type %s, got %s", i, tokenType, tok.Type)
+		}
+	}
+}
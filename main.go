@@ -1,18 +1,256 @@
 package main
 
 import (
+	"bytes"
+	"flag"
 	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
 	"monkey/repl"
+	"monkey/vm"
 	"os"
 	"os/user"
+	"path/filepath"
+	"strings"
 )
 
+const (
+	exitOK           = 0
+	exitRuntimeError = 1
+	exitParseError   = 2
+	exitUsage        = 64
+)
+
+const usage = `Usage:
+	monkey run [flags] <file> [args...]      run a Monkey script
+	monkey eval [flags] -e <expr> [args...]  evaluate an expression and print the result
+	monkey build [-o <out>] [-strip] <file>  compile a Monkey script to a .mkc file
+	monkey repl                              start an interactive session
+
+Flags:
+	-checked         report integer overflow as an error
+	-max-depth <n>   limit nested function calls, 0 for no limit (default 10000)
+	-engine <name>   execute with the tree-walking "eval" or the bytecode "vm" (default eval)
+	-o <out>         write the compiled program to out (default <file> with a .mkc extension)
+	-strip           leave out the source positions used in error messages
+
+Compiled .mkc files are always run with the vm engine.
+`
+
 func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(arguments []string, stdout, stderr io.Writer) int {
+	if len(arguments) == 0 {
+		return startRepl(stdout)
+	}
+
+	switch arguments[0] {
+	case "run":
+		return runCommand(arguments[1:], stderr)
+	case "eval":
+		return evalCommand(arguments[1:], stdout, stderr)
+	case "build":
+		return buildCommand(arguments[1:], stderr)
+	case "repl":
+		return startRepl(stdout)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n\n%s", arguments[0], usage)
+		return exitUsage
+	}
+}
+
+func runCommand(arguments []string, stderr io.Writer) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	checked := flags.Bool("checked", false, "report integer overflow as an error")
+	maxDepth := flags.Int("max-depth", evaluator.DefaultMaxCallDepth, "limit nested function calls, 0 for no limit")
+	engine := flags.String("engine", "eval", `execute with the tree-walking "eval" or the bytecode "vm"`)
+	if err := flags.Parse(arguments); err != nil {
+		return exitUsage
+	}
+	if *engine != "eval" && *engine != "vm" {
+		fmt.Fprintf(stderr, "unknown engine %q\n\n%s", *engine, usage)
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintf(stderr, "run: missing file name\n\n%s", usage)
+		return exitUsage
+	}
+
+	path := flags.Arg(0)
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "run: %s\n", err)
+		return exitUsage
+	}
+
+	opts := options(*checked, *maxDepth)
+	opts.Args = flags.Args()[1:]
+	if compiler.IsBytecode(source) {
+		bytecode, err := compiler.ReadBytecode(bytes.NewReader(source))
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", path, err)
+			return exitParseError
+		}
+		_, code := report(path, vm.NewWithOptions(bytecode, opts).Run(), stderr)
+		return code
+	}
+	_, code := execute(path, string(source), *engine, opts, stderr)
+	return code
+}
+
+func evalCommand(arguments []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("eval", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	expression := flags.String("e", "", "expression to evaluate")
+	checked := flags.Bool("checked", false, "report integer overflow as an error")
+	maxDepth := flags.Int("max-depth", evaluator.DefaultMaxCallDepth, "limit nested function calls, 0 for no limit")
+	engine := flags.String("engine", "eval", `execute with the tree-walking "eval" or the bytecode "vm"`)
+	if err := flags.Parse(arguments); err != nil {
+		return exitUsage
+	}
+	if *engine != "eval" && *engine != "vm" {
+		fmt.Fprintf(stderr, "unknown engine %q\n\n%s", *engine, usage)
+		return exitUsage
+	}
+	if *expression == "" {
+		fmt.Fprintf(stderr, "eval: missing -e expression\n\n%s", usage)
+		return exitUsage
+	}
+
+	opts := options(*checked, *maxDepth)
+	opts.Args = flags.Args()
+	evaluated, code := execute("<eval>", *expression, *engine, opts, stderr)
+	if code == exitOK && evaluated != nil {
+		fmt.Fprintln(stdout, evaluated.Inspect())
+	}
+	return code
+}
+
+func buildCommand(arguments []string, stderr io.Writer) int {
+	flags := flag.NewFlagSet("build", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	output := flags.String("o", "", "write the compiled program to this file")
+	strip := flags.Bool("strip", false, "leave out the source positions used in error messages")
+	if err := flags.Parse(arguments); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintf(stderr, "build: expected one file name\n\n%s", usage)
+		return exitUsage
+	}
+
+	path := flags.Arg(0)
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "build: %s\n", err)
+		return exitUsage
+	}
+	if *output == "" {
+		*output = strings.TrimSuffix(path, filepath.Ext(path)) + ".mkc"
+	}
+
+	program, code := parse(path, string(source), stderr)
+	if program == nil {
+		return code
+	}
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", path, err)
+		return exitParseError
+	}
+
+	var buf bytes.Buffer
+	if err := compiler.WriteBytecode(&buf, comp.Bytecode(), !*strip); err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", path, err)
+		return exitParseError
+	}
+	if err := os.WriteFile(*output, buf.Bytes(), 0o644); err != nil {
+		fmt.Fprintf(stderr, "build: %s\n", err)
+		return exitRuntimeError
+	}
+	return exitOK
+}
+
+func startRepl(stdout io.Writer) int {
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
 	}
-	fmt.Printf("Hello %s! This is the Monkey programming language!\n", user.Username)
-	fmt.Printf("Feel free to type in some code and see what happens!\n")
-	repl.Start(os.Stdin, os.Stdout)
+	fmt.Fprintf(stdout, "Hello %s! This is the Monkey programming language!\n", user.Username)
+	fmt.Fprintf(stdout, "Feel free to type in some code and see what happens!\n")
+	repl.Start(os.Stdin, stdout)
+	return exitOK
+}
+
+// options returns the evaluator settings for the -checked and -max-depth
+// flags. A -max-depth of zero or less means no limit.
+func options(checked bool, maxDepth int) evaluator.Options {
+	if maxDepth <= 0 {
+		maxDepth = -1
+	}
+	return evaluator.Options{MaxCallDepth: maxDepth, CheckedArithmetic: checked}
+}
+
+func execute(name, source, engine string, opts evaluator.Options, stderr io.Writer) (object.Object, int) {
+	program, code := parse(name, source, stderr)
+	if program == nil {
+		return nil, code
+	}
+
+	var evaluated object.Object
+	if engine == "vm" {
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", name, err)
+			return nil, exitParseError
+		}
+		evaluated = vm.NewWithOptions(comp.Bytecode(), opts).Run()
+	} else {
+		evaluated = evaluator.EvalWithOptions(program, object.NewEnvironment(), opts)
+	}
+	return report(name, evaluated, stderr)
+}
+
+func parse(name, source string, stderr io.Writer) (*ast.Program, int) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.ParseErrors()) > 0 {
+		for _, err := range p.ParseErrors() {
+			fmt.Fprintf(stderr, "%s:%s\n", name, err.Snippet())
+		}
+		return nil, exitParseError
+	}
+
+	macros := object.NewEnvironment()
+	evaluator.DefineMacros(program, macros)
+	expanded, err := evaluator.ExpandMacros(program, macros)
+	if err != nil {
+		report(name, err, stderr)
+		return nil, exitParseError
+	}
+	return expanded.(*ast.Program), exitOK
+}
+
+// report prints a runtime error and returns the exit code for the result
+// of a program.
+func report(name string, evaluated object.Object, stderr io.Writer) (object.Object, int) {
+	if errObj, ok := evaluated.(*object.Error); ok {
+		fmt.Fprintf(stderr, "%s:%s: %s\n", name, errObj.Pos, errObj.Message)
+		for _, line := range errObj.Traceback() {
+			fmt.Fprintf(stderr, "\t%s\n", line)
+		}
+		return evaluated, exitRuntimeError
+	}
+	return evaluated, exitOK
 }
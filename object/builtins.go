@@ -0,0 +1,191 @@
+package object
+
+import "fmt"
+
+// Builtins lists the builtin functions shared by the evaluator and the
+// virtual machine. The compiler refers to them by their index, so new
+// builtins go at the end.
+var Builtins = []struct {
+	Name    string
+	Builtin *Builtin
+}{
+	{
+		"len",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+
+				case *String:
+					return &Integer{Value: int64(len(arg.Value))}
+				case *Array:
+					return &Integer{Value: int64(len(arg.Elements))}
+				case *Hash:
+					return &Integer{Value: int64(len(arg.Pairs))}
+				default:
+					return newError("argument to `len` not supported, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"first",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+
+				case *Array:
+					if len(arg.Elements) > 0 {
+						return arg.Elements[0]
+					} else {
+						return NULL
+					}
+				default:
+					return newError("argument to `first` not supported, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"last",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+
+				case *Array:
+					if len(arg.Elements) > 0 {
+						return arg.Elements[len(arg.Elements)-1]
+					} else {
+						return NULL
+					}
+				default:
+					return newError("argument to `last` not supported, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"rest",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+
+				case *Array:
+					size := len(arg.Elements) - 1
+					if size > 0 {
+						result := make([]Object, size)
+						copy(result, arg.Elements[1:size+1])
+						return &Array{Elements: result}
+					} else {
+						return NULL
+					}
+				default:
+					return newError("argument to `last` not supported, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"push",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+
+				switch arg := args[0].(type) {
+
+				case *Array:
+					size := len(arg.Elements)
+					result := make([]Object, size+1)
+					copy(result, arg.Elements)
+					result[size] = args[1]
+					return &Array{Elements: result}
+				default:
+					return newError("argument to `last` not supported, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"throw",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+
+				if caught, ok := args[0].(*Hash); ok && caught.Caught != nil {
+					rethrown := *caught.Caught
+					rethrown.Stack = append([]Frame(nil), rethrown.Stack...)
+					return &rethrown
+				}
+				if message, ok := args[0].(*String); ok {
+					return &Error{Message: message.Value, Value: message}
+				}
+				return &Error{Message: args[0].Inspect(), Value: args[0]}
+			},
+		},
+	},
+	{
+		"puts",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				for _, arg := range args {
+					fmt.Println(arg.Inspect())
+				}
+				return NULL
+			},
+		},
+	},
+	{
+		"args",
+		ArgsBuiltin(nil),
+	},
+}
+
+// ArgsBuiltin returns an `args` builtin that returns scriptArgs. The one in
+// Builtins returns no arguments; an evaluation given script arguments uses
+// its own instead, so concurrent evaluations do not share them.
+func ArgsBuiltin(scriptArgs []string) *Builtin {
+	return &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 0 {
+				return newError("wrong number of arguments. got=%d, want=0", len(args))
+			}
+			elements := make([]Object, len(scriptArgs))
+			for i, arg := range scriptArgs {
+				elements[i] = &String{Value: arg}
+			}
+			return &Array{Elements: elements}
+		},
+	}
+}
+
+func GetBuiltinByName(name string) *Builtin {
+	for _, def := range Builtins {
+		if def.Name == name {
+			return def.Builtin
+		}
+	}
+	return nil
+}
+
+func newError(format string, a ...any) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
+}
@@ -23,6 +23,19 @@ func (e *Environment) Set(name string, value Object) Object {
 	return value
 }
 
+// Assign updates an existing binding in the innermost scope that defines
+// name. It reports false if name is not bound anywhere in the chain.
+func (e *Environment) Assign(name string, value Object) (Object, bool) {
+	if _, ok := e.store[name]; ok {
+		e.store[name] = value
+		return value, true
+	}
+	if e.outer != nil {
+		return e.outer.Assign(name, value)
+	}
+	return nil, false
+}
+
 func (e *Environment) Get(name string) (Object, bool) {
 	obj, ok := e.store[name]
 	if !ok && e.outer != nil {
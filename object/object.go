@@ -3,7 +3,11 @@ package object
 import (
 	"bytes"
 	"fmt"
+	"hash/fnv"
 	"monkey/ast"
+	"monkey/code"
+	"monkey/token"
+	"strconv"
 	"strings"
 )
 
@@ -11,20 +15,31 @@ type ObjectType string
 
 const (
 	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	NULL_OBJ         = "NULL"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
 	ERROR_OBJ        = "ERROR"
 	FUNCTION_OBJ     = "FUNCTION"
 	STRING_OBJ       = "STRING"
 	BUILTIN_OBJ      = "BUILTIN"
 	ARRAY_OBJ        = "ARRAY"
+	HASH_OBJ         = "HASH"
+	QUOTE_OBJ        = "QUOTE"
+	MACRO_OBJ        = "MACRO"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	UPVALUE_OBJ           = "UPVALUE"
 )
 
 var (
-	TRUE  = &Boolean{Value: true}
-	FALSE = &Boolean{Value: false}
-	NULL  = &Null{}
+	TRUE     = &Boolean{Value: true}
+	FALSE    = &Boolean{Value: false}
+	NULL     = &Null{}
+	BREAK    = &Break{}
+	CONTINUE = &Continue{}
 )
 
 type Object interface {
@@ -32,6 +47,15 @@ type Object interface {
 	Inspect() string
 }
 
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+type Hashable interface {
+	HashKey() HashKey
+}
+
 type Integer struct {
 	Value int64
 }
@@ -44,6 +68,26 @@ func (i *Integer) Type() ObjectType {
 	return INTEGER_OBJ
 }
 
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Inspect() string {
+	str := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(str, ".eIN") {
+		str += ".0"
+	}
+	return str
+}
+
+func (f *Float) Type() ObjectType {
+	return FLOAT_OBJ
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -56,6 +100,14 @@ func (b *Boolean) Type() ObjectType {
 	return BOOLEAN_OBJ
 }
 
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+	return HashKey{Type: b.Type(), Value: value}
+}
+
 type Null struct{}
 
 func (n *Null) Inspect() string {
@@ -78,11 +130,89 @@ func (rv *ReturnValue) Type() ObjectType {
 	return RETURN_VALUE_OBJ
 }
 
+// Break and Continue are loop control signals. Like ReturnValue they
+// propagate out of blocks until the enclosing loop consumes them.
+type Break struct{}
+
+func (b *Break) Inspect() string {
+	return "break"
+}
+
+func (b *Break) Type() ObjectType {
+	return BREAK_OBJ
+}
+
+type Continue struct{}
+
+func (c *Continue) Inspect() string {
+	return "continue"
+}
+
+func (c *Continue) Type() ObjectType {
+	return CONTINUE_OBJ
+}
+
 type Error struct {
 	Message string
+	Pos     token.Position
+	Value   Object  // the value passed to throw, nil for runtime errors
+	Stack   []Frame // calls the error unwound through, innermost first
+	Omitted int     // frames dropped before the last one in Stack
+}
+
+// Frame is a function call that was active when an error occurred.
+type Frame struct {
+	Function string // empty for anonymous functions
+	Pos      token.Position
+	Repeated int // further calls from the same place folded into this frame
+}
+
+func (f Frame) String() string {
+	name := "anonymous function"
+	if f.Function != "" {
+		name = "`" + f.Function + "`"
+	}
+	return fmt.Sprintf("in %s called at %s", name, f.Pos)
+}
+
+// AddFrame records a call the error unwinds through. A call repeating the
+// last frame, as in deep recursion, is counted in that frame. Once limit
+// frames are recorded, the last one is replaced by each new frame and
+// counted as omitted, so the outermost call is always kept.
+func (e *Error) AddFrame(frame Frame, limit int) {
+	n := len(e.Stack)
+	if n > 0 && e.Stack[n-1].Function == frame.Function && e.Stack[n-1].Pos == frame.Pos {
+		e.Stack[n-1].Repeated++
+		return
+	}
+	if n < limit {
+		e.Stack = append(e.Stack, frame)
+		return
+	}
+	e.Omitted += 1 + e.Stack[n-1].Repeated
+	e.Stack[n-1] = frame
+}
+
+// Traceback returns the lines describing the stack of the error, with
+// repeated and omitted frames shown as "... N more".
+func (e *Error) Traceback() []string {
+	var lines []string
+	for i, frame := range e.Stack {
+		if i == len(e.Stack)-1 && e.Omitted > 0 {
+			lines = append(lines, fmt.Sprintf("... %d more frames", e.Omitted))
+		}
+		lines = append(lines, frame.String())
+		if frame.Repeated > 0 {
+			lines = append(lines, fmt.Sprintf("... %d more", frame.Repeated))
+		}
+	}
+	return lines
 }
 
 func (e *Error) Inspect() string {
+	if e.Pos.IsValid() {
+		return fmt.Sprintf("Error at %s: %s", e.Pos, e.Message)
+	}
 	return fmt.Sprintf("Error: %s", e.Message)
 }
 
@@ -91,7 +221,9 @@ func (e *Error) Type() ObjectType {
 }
 
 type Function struct {
-	Parameters []*ast.Identifier
+	Name       string
+	Parameters []*ast.Parameter
+	Rest       *ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
 }
@@ -106,6 +238,9 @@ func (f *Function) Inspect() string {
 	for i, param := range f.Parameters {
 		params[i] = param.String()
 	}
+	if f.Rest != nil {
+		params = append(params, "..."+f.Rest.String())
+	}
 	out.WriteString("fn(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") {\n}")
@@ -114,6 +249,46 @@ func (f *Function) Inspect() string {
 	return out.String()
 }
 
+// Quote holds unevaluated code, as returned by quote.
+type Quote struct {
+	Node ast.Node
+}
+
+func (q *Quote) Type() ObjectType {
+	return QUOTE_OBJ
+}
+
+func (q *Quote) Inspect() string {
+	return "QUOTE(" + q.Node.String() + ")"
+}
+
+// Macro is called with the unevaluated code of its arguments, as quotes,
+// and returns a quote with the code that replaces the call.
+type Macro struct {
+	Name       string
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+func (m *Macro) Type() ObjectType {
+	return MACRO_OBJ
+}
+
+func (m *Macro) Inspect() string {
+	var out bytes.Buffer
+	params := make([]string, len(m.Parameters))
+	for i, param := range m.Parameters {
+		params[i] = param.String()
+	}
+	out.WriteString("macro(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(m.Body.String())
+	out.WriteString("\n}")
+	return out.String()
+}
+
 type String struct {
 	Value string
 }
@@ -126,6 +301,12 @@ func (s *String) Type() ObjectType {
 	return STRING_OBJ
 }
 
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
+
 type BuiltinFunction func(args ...Object) Object
 
 type Builtin struct {
@@ -157,3 +338,112 @@ func (a *Array) Inspect() string {
 
 	return fmt.Sprintf("[%s]", strings.Join(elements, ", "))
 }
+
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+// Hash keeps its pairs in the order their keys were first inserted, so
+// that printing and iterating over a hash are deterministic. Pairs must
+// be added with Set to keep Keys up to date.
+type Hash struct {
+	Pairs map[HashKey]HashPair
+	Keys  []HashKey // keys of Pairs in insertion order
+
+	// Caught is the error a catch block received this hash for, so that
+	// throwing the hash again raises the original error.
+	Caught *Error
+}
+
+func NewHash() *Hash {
+	return &Hash{Pairs: make(map[HashKey]HashPair)}
+}
+
+// Set stores pair under key. A key that is already present keeps its
+// position.
+func (h *Hash) Set(key HashKey, pair HashPair) {
+	if _, ok := h.Pairs[key]; !ok {
+		h.Keys = append(h.Keys, key)
+	}
+	h.Pairs[key] = pair
+}
+
+// Ordered returns the pairs of the hash in insertion order.
+func (h *Hash) Ordered() []HashPair {
+	pairs := make([]HashPair, len(h.Keys))
+	for i, key := range h.Keys {
+		pairs[i] = h.Pairs[key]
+	}
+	return pairs
+}
+
+func (h *Hash) Type() ObjectType {
+	return HASH_OBJ
+}
+
+func (h *Hash) Inspect() string {
+	pairs := []string{}
+
+	for _, pair := range h.Ordered() {
+		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
+	}
+
+	return fmt.Sprintf("{%s}", strings.Join(pairs, ", "))
+}
+
+// CompiledFunction is a function literal compiled to bytecode.
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int
+	NumDefaults   int
+	HasRest       bool // the rest parameter is the local after the parameters
+	Name          string
+	// Prologue is the offset where the body starts, after the code that
+	// binds default values and destructures parameters.
+	Prologue   int
+	Positions  code.LineTable
+	LocalNames []string // names of the local slots, empty for hidden ones
+	FreeNames  []string
+}
+
+func (cf *CompiledFunction) Type() ObjectType {
+	return COMPILED_FUNCTION_OBJ
+}
+
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []*Upvalue
+}
+
+// Type reports closures as functions, which is what they are to programs.
+func (c *Closure) Type() ObjectType {
+	return FUNCTION_OBJ
+}
+
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
+
+// Upvalue is a variable captured by a closure. While the function that
+// declares the variable is running, the upvalue is open and the variable
+// lives in stack slot Slot; after the function returns, the value is kept
+// in Value.
+type Upvalue struct {
+	Slot  int
+	Open  bool
+	Value Object
+}
+
+func (u *Upvalue) Type() ObjectType {
+	return UPVALUE_OBJ
+}
+
+func (u *Upvalue) Inspect() string {
+	return "upvalue"
+}
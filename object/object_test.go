@@ -0,0 +1,67 @@
+package object
+
+import "testing"
+
+func TestStringHashKey(t *testing.T) {
+	hello1 := &String{Value: "Hello World"}
+	hello2 := &String{Value: "Hello World"}
+	diff1 := &String{Value: "My name is johnny"}
+	diff2 := &String{Value: "My name is johnny"}
+
+	if hello1.HashKey() != hello2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+	if diff1.HashKey() != diff2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+	if hello1.HashKey() == diff1.HashKey() {
+		t.Errorf("strings with different content have same hash keys")
+	}
+}
+
+func TestHashKeyTypes(t *testing.T) {
+	one := &Integer{Value: 1}
+	truth := &Boolean{Value: true}
+
+	if one.HashKey() == truth.HashKey() {
+		t.Errorf("integer and boolean with same value have same hash keys")
+	}
+	if one.HashKey() != (&Integer{Value: 1}).HashKey() {
+		t.Errorf("integers with same value have different hash keys")
+	}
+}
+
+func TestHashKeepsInsertionOrder(t *testing.T) {
+	hash := NewHash()
+	for i, name := range []string{"c", "a", "b", "a"} {
+		key := &String{Value: name}
+		hash.Set(key.HashKey(), HashPair{Key: key, Value: &Integer{Value: int64(i)}})
+	}
+
+	expected := "{c: 0, a: 3, b: 2}"
+	if hash.Inspect() != expected {
+		t.Errorf("expected %q, got %q", expected, hash.Inspect())
+	}
+	if len(hash.Keys) != len(hash.Pairs) {
+		t.Errorf("hash has %d keys for %d pairs", len(hash.Keys), len(hash.Pairs))
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{3.14, "3.14"},
+		{2, "2.0"},
+		{-0.5, "-0.5"},
+		{1e21, "1e+21"},
+	}
+
+	for _, test := range tests {
+		f := &Float{Value: test.value}
+		if f.Inspect() != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, f.Inspect())
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package parser
+
+import (
+	"fmt"
+	"monkey/token"
+	"strings"
+)
+
+type ErrorKind int
+
+const (
+	UnexpectedToken ErrorKind = iota
+	NoPrefixParseFn
+	InvalidLiteral
+	IllegalToken
+	SyntaxError
+)
+
+var errorKindNames = map[ErrorKind]string{
+	UnexpectedToken: "unexpected token",
+	NoPrefixParseFn: "no prefix parse function",
+	InvalidLiteral:  "invalid literal",
+	IllegalToken:    "illegal token",
+	SyntaxError:     "syntax error",
+}
+
+func (k ErrorKind) String() string {
+	if name, ok := errorKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("ErrorKind(%d)", int(k))
+}
+
+// ParseError describes a single problem found while parsing. Expected is
+// only set for UnexpectedToken errors. Line holds the full source line the
+// error points into so the error can be rendered without the source.
+type ParseError struct {
+	Kind     ErrorKind
+	Message  string
+	Expected token.TokenType
+	Actual   token.Token
+	Pos      token.Position
+	Line     string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+}
+
+// Snippet renders the error followed by the offending source line and a
+// caret under the error position.
+func (e *ParseError) Snippet() string {
+	var out strings.Builder
+	out.WriteString(e.Error())
+	if !e.Pos.IsValid() {
+		return out.String()
+	}
+	out.WriteString("\n\t")
+	out.WriteString(e.Line)
+	out.WriteString("\n\t")
+	for i := 0; i < e.Pos.Column-1 && i < len(e.Line); i++ {
+		if e.Line[i] == '\t' {
+			out.WriteByte('\t')
+		} else {
+			out.WriteByte(' ')
+		}
+	}
+	for i := len(e.Line); i < e.Pos.Column-1; i++ {
+		out.WriteByte(' ')
+	}
+	out.WriteString("^")
+	return out.String()
+}
+
+func sourceLine(source string, pos token.Position) string {
+	if !pos.IsValid() || pos.Offset > len(source) {
+		return ""
+	}
+	start := strings.LastIndexByte(source[:pos.Offset], '\n') + 1
+	end := strings.IndexByte(source[pos.Offset:], '\n')
+	if end < 0 {
+		return source[start:]
+	}
+	return source[start : pos.Offset+end]
+}
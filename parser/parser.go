@@ -11,35 +11,69 @@ import (
 const (
 	_ int = iota
 	LOWEST
+	ASSIGNMENT  // = += -= *= /=
+	LOGICAL_OR  // ||
+	LOGICAL_AND // &&
 	EQUALS      // ==
-	LESSGREATER // < >
+	LESSGREATER // < > <= >=
 	SUM         // +
-	PRODUCT     // *
+	PRODUCT     // * / %
 	PREFIX      // -x or !x
 	CALL        // myFunction()
 	INDEX       // array[index]
 )
 
 var precedences = map[token.TokenType]int{
+	token.ASSIGN:          ASSIGNMENT,
+	token.PLUS_ASSIGN:     ASSIGNMENT,
+	token.MINUS_ASSIGN:    ASSIGNMENT,
+	token.ASTERISK_ASSIGN: ASSIGNMENT,
+	token.SLASH_ASSIGN:    ASSIGNMENT,
+
 	token.EQ:       EQUALS,
 	token.NOT_EQ:   EQUALS,
+	token.OR:       LOGICAL_OR,
+	token.AND:      LOGICAL_AND,
 	token.LT:       LESSGREATER,
 	token.GT:       LESSGREATER,
+	token.LT_EQ:    LESSGREATER,
+	token.GT_EQ:    LESSGREATER,
 	token.PLUS:     SUM,
 	token.MINUS:    SUM,
 	token.SLASH:    PRODUCT,
 	token.ASTERISK: PRODUCT,
+	token.PERCENT:  PRODUCT,
 	token.LPAREN:   CALL,
 	token.LBRACKET: INDEX,
 }
 
 type Parser struct {
 	lexer  *lexer.Lexer
-	errors []string
+	errors []*ParseError
+
+	// panicking is set once an error is reported and cleared when the
+	// parser resynchronizes. Errors reported in between are dropped.
+	panicking bool
+
+	// loopDepth counts the loops enclosing the current token within the
+	// current function body, so break and continue can be validated.
+	loopDepth int
+
+	// braceDepth counts the braces opened and not yet closed up to the
+	// current token, and blocks holds the braceDepth inside each block
+	// being parsed, innermost last. Recovering from an error uses them to
+	// tell the '}' of the enclosing block from the '}' of a hash literal or
+	// match expression.
+	braceDepth int
+	blocks     []int
 
 	curToken  token.Token
 	peekToken token.Token
 
+	// comments collects the COMMENT tokens of a lexer created with
+	// lexer.NewWithComments, which are skipped otherwise.
+	comments []*ast.Comment
+
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
 }
@@ -74,7 +108,7 @@ func (p *Parser) curPrecedence() int {
 func New(lexer *lexer.Lexer) *Parser {
 	p := &Parser{
 		lexer:  lexer,
-		errors: []string{},
+		errors: []*ParseError{},
 	}
 
 	p.nextToken()
@@ -83,25 +117,41 @@ func New(lexer *lexer.Lexer) *Parser {
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENTIFIER, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.MATCH, p.parseMatchExpression)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.ILLEGAL, p.parseIllegal)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.EQ, p.parseInfixExpression)
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
 	p.registerInfix(token.SLASH, p.parseInfixExpression)
 	p.registerInfix(token.ASTERISK, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseLogicalExpression)
+	p.registerInfix(token.OR, p.parseLogicalExpression)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.SLASH_ASSIGN, p.parseAssignExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 
@@ -109,17 +159,89 @@ func New(lexer *lexer.Lexer) *Parser {
 }
 
 func (parser *Parser) Errors() []string {
+	messages := make([]string, len(parser.errors))
+	for i, err := range parser.errors {
+		messages[i] = err.Error()
+	}
+	return messages
+}
+
+func (parser *Parser) ParseErrors() []*ParseError {
 	return parser.errors
 }
 
-func (parser *Parser) peekError(token token.TokenType) {
-	message := fmt.Sprintf("Expected %s, got %s", token, parser.peekToken.Type)
-	parser.errors = append(parser.errors, message)
+func (parser *Parser) peekError(expected token.TokenType) {
+	if parser.peekToken.Type == token.ILLEGAL {
+		parser.newError(IllegalToken, parser.peekToken, "%s", parser.peekToken.Literal)
+		return
+	}
+	err := parser.newError(UnexpectedToken, parser.peekToken, "Expected %s, got %s", expected, parser.peekToken.Type)
+	err.Expected = expected
+}
+
+func (parser *Parser) newError(kind ErrorKind, actual token.Token, format string, args ...any) *ParseError {
+	err := &ParseError{
+		Kind:    kind,
+		Message: fmt.Sprintf(format, args...),
+		Actual:  actual,
+		Pos:     actual.Pos,
+		Line:    sourceLine(parser.lexer.Input(), actual.Pos),
+	}
+	if !parser.panicking {
+		parser.errors = append(parser.errors, err)
+		parser.panicking = true
+	}
+	return err
+}
+
+// synchronize skips the remainder of a broken statement. It stops on a
+// ';' or on the '}' that closes the enclosing block, or right before a
+// token that starts a new statement or closes the enclosing block. Braces
+// opened in the broken statement, including those of a hash literal or
+// match expression the error occurred in, are skipped with their contents.
+func (parser *Parser) synchronize() {
+	parser.panicking = false
+	block := 0
+	if len(parser.blocks) > 0 {
+		block = parser.blocks[len(parser.blocks)-1]
+	}
+	for !parser.curTokenIs(token.EOF) {
+		depth := parser.braceDepth
+		switch parser.curToken.Type {
+		case token.RBRACE:
+			if depth < block {
+				return
+			}
+		case token.SEMICOLON:
+			if depth == block {
+				return
+			}
+		}
+		if depth == block {
+			switch parser.peekToken.Type {
+			case token.LET, token.RETURN, token.WHILE, token.FOR, token.BREAK, token.CONTINUE, token.RBRACE, token.EOF:
+				return
+			}
+		}
+		parser.nextToken()
+	}
 }
 
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
+	switch p.curToken.Type {
+	case token.LBRACE:
+		p.braceDepth++
+	case token.RBRACE:
+		if p.braceDepth > 0 {
+			p.braceDepth--
+		}
+	}
 	p.peekToken = p.lexer.NextToken()
+	for p.peekToken.Type == token.COMMENT {
+		p.comments = append(p.comments, &ast.Comment{Token: p.peekToken})
+		p.peekToken = p.lexer.NextToken()
+	}
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
@@ -128,11 +250,14 @@ func (p *Parser) ParseProgram() *ast.Program {
 
 	for p.curToken.Type != token.EOF {
 		stmt := p.parseStatement()
-		if stmt != nil {
+		if p.panicking {
+			p.synchronize()
+		} else if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
 		p.nextToken()
 	}
+	program.Comments = p.comments
 	return program
 }
 
@@ -142,6 +267,12 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.FOR:
+		return p.parseForStatement()
+	case token.BREAK, token.CONTINUE:
+		return p.parseLoopControlStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -150,10 +281,7 @@ func (p *Parser) parseStatement() ast.Statement {
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
 	stmt.Expression = p.parseExpression(LOWEST)
-
-	if p.peekTokenIs(token.SEMICOLON) {
-		p.nextToken()
-	}
+	p.endStatement()
 
 	return stmt
 }
@@ -162,21 +290,22 @@ func (p *Parser) parseReturnStatement() ast.Statement {
 	stmt := &ast.ReturnStatement{Token: p.curToken}
 	p.nextToken()
 	stmt.ReturnValue = p.parseExpression(LOWEST)
-
-	if p.peekTokenIs(token.SEMICOLON) {
-		p.nextToken()
-	}
+	p.endStatement()
 	return stmt
 }
 
 func (p *Parser) parseLetStatement() ast.Statement {
 	stmt := &ast.LetStatement{Token: p.curToken}
 
-	if !p.expectPeek(token.IDENTIFIER) {
+	target := p.parseBindingTarget()
+	if target == nil {
 		return nil
 	}
-
-	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if name, ok := target.(*ast.Identifier); ok {
+		stmt.Name = name
+	} else {
+		stmt.Pattern = target
+	}
 
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
@@ -184,14 +313,170 @@ func (p *Parser) parseLetStatement() ast.Statement {
 	p.nextToken()
 
 	stmt.Value = p.parseExpression(LOWEST)
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok && stmt.Name != nil {
+		fl.Name = stmt.Name.Value
+	}
+	p.endStatement()
+
+	return stmt
+}
 
-	for !p.curTokenIs(token.SEMICOLON) {
+// parseBindingTarget parses the identifier or destructuring pattern that
+// follows the current token.
+func (p *Parser) parseBindingTarget() ast.Expression {
+	switch {
+	case p.peekTokenIs(token.LBRACKET):
+		p.nextToken()
+		return p.parseArrayPattern()
+	case p.peekTokenIs(token.LBRACE):
 		p.nextToken()
+		return p.parseHashPattern()
+	}
+
+	if !p.expectPeek(token.IDENTIFIER) {
+		return nil
+	}
+	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+}
+
+func (p *Parser) parseArrayPattern() ast.Expression {
+	pattern := &ast.ArrayPattern{Token: p.curToken}
+
+	for !p.peekTokenIs(token.RBRACKET) {
+		if p.peekTokenIs(token.ELLIPSIS) {
+			p.nextToken()
+			if !p.expectPeek(token.IDENTIFIER) {
+				return nil
+			}
+			pattern.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			if !p.peekTokenIs(token.RBRACKET) {
+				p.newError(SyntaxError, p.peekToken, "rest element %s must be the last element", pattern.Rest.Value)
+				return nil
+			}
+			break
+		}
+
+		element := p.parseBindingTarget()
+		if element == nil {
+			return nil
+		}
+		pattern.Elements = append(pattern.Elements, element)
+
+		if !p.peekTokenIs(token.RBRACKET) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	pattern.Rbracket = p.curToken.Pos
+
+	return pattern
+}
+
+func (p *Parser) parseHashPattern() ast.Expression {
+	pattern := &ast.HashPattern{Token: p.curToken}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.IDENTIFIER) {
+			return nil
+		}
+		pattern.Keys = append(pattern.Keys, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	pattern.Rbrace = p.curToken.Pos
+
+	return pattern
+}
+
+func (p *Parser) parseWhileStatement() ast.Statement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseLoopBody()
+	p.endStatement()
+
+	return stmt
+}
+
+func (p *Parser) parseForStatement() ast.Statement {
+	stmt := &ast.ForStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.IDENTIFIER) {
+		return nil
+	}
+	stmt.Variable = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseLoopBody()
+	p.endStatement()
+
+	return stmt
+}
+
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth++
+	defer func() { p.loopDepth-- }()
+	return p.parseBlockStatement()
+}
+
+func (p *Parser) parseLoopControlStatement() ast.Statement {
+	if p.loopDepth == 0 {
+		p.newError(SyntaxError, p.curToken, "%s outside of a loop", p.curToken.Literal)
+		return nil
 	}
 
+	var stmt ast.Statement
+	if p.curTokenIs(token.BREAK) {
+		stmt = &ast.BreakStatement{Token: p.curToken}
+	} else {
+		stmt = &ast.ContinueStatement{Token: p.curToken}
+	}
+	p.endStatement()
 	return stmt
 }
 
+// endStatement consumes an optional trailing ';'. A broken statement is
+// left alone so that synchronize starts from the token the error was
+// reported on.
+func (p *Parser) endStatement() {
+	if !p.panicking && p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+}
+
 func (p *Parser) curTokenIs(t token.TokenType) bool {
 	return p.curToken.Type == t
 }
@@ -215,8 +500,7 @@ func (p *Parser) parseIdentifier() ast.Expression {
 }
 
 func (p *Parser) noPrefixParseFnError(tokenType token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s", tokenType)
-	p.errors = append(p.errors, msg)
+	p.newError(NoPrefixParseFn, p.curToken, "no prefix parse function for %s", tokenType)
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
@@ -242,14 +526,29 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	literal := &ast.IntegerLiteral{Token: p.curToken}
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.newError(InvalidLiteral, p.curToken, "could not parse %q as integer", p.curToken.Literal)
 		return nil
 	}
 	literal.Value = value
 	return literal
 }
 
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	literal := &ast.FloatLiteral{Token: p.curToken}
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	if err != nil {
+		p.newError(InvalidLiteral, p.curToken, "could not parse %q as float", p.curToken.Literal)
+		return nil
+	}
+	literal.Value = value
+	return literal
+}
+
+func (p *Parser) parseIllegal() ast.Expression {
+	p.newError(IllegalToken, p.curToken, "%s", p.curToken.Literal)
+	return nil
+}
+
 func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
@@ -257,6 +556,9 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	al := &ast.ArrayLiteral{Token: p.curToken}
 	al.Elements = p.parseExpressionList(token.RBRACKET)
+	if p.curTokenIs(token.RBRACKET) {
+		al.Rbracket = p.curToken.Pos
+	}
 	return al
 }
 func (p *Parser) parsePrefixExpression() ast.Expression {
@@ -281,6 +583,43 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+func (p *Parser) parseLogicalExpression(left ast.Expression) ast.Expression {
+	expression := &ast.LogicalExpression{
+		Token:    p.curToken,
+		Left:     left,
+		Operator: p.curToken.Literal,
+	}
+
+	precedence := p.curPrecedence()
+	p.nextToken()
+	expression.Right = p.parseExpression(precedence)
+
+	return expression
+}
+
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	case nil:
+		return nil
+	default:
+		p.newError(SyntaxError, p.curToken, "cannot assign to %s", target.String())
+		return nil
+	}
+
+	expression := &ast.AssignExpression{
+		Token:    p.curToken,
+		Target:   target,
+		Operator: p.curToken.Literal,
+	}
+
+	// Assignment is right-associative: a = b = c is a = (b = c).
+	p.nextToken()
+	expression.Value = p.parseExpression(ASSIGNMENT - 1)
+
+	return expression
+}
+
 func (p *Parser) parseBoolean() ast.Expression {
 	return &ast.Boolean{
 		Token: p.curToken,
@@ -303,7 +642,6 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	}
 
 	if !p.expectPeek(token.LPAREN) {
-		p.errors = append(p.errors, "expected '('")
 		return nil
 	}
 
@@ -311,12 +649,10 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	ie.Condition = p.parseExpression(LOWEST)
 
 	if !p.expectPeek(token.RPAREN) {
-		p.errors = append(p.errors, "expected ')'")
 		return nil
 	}
 
 	if !p.expectPeek(token.LBRACE) {
-		p.errors = append(p.errors, "expected '{'")
 		return nil
 	}
 
@@ -324,8 +660,15 @@ func (p *Parser) parseIfExpression() ast.Expression {
 
 	if p.peekTokenIs(token.ELSE) {
 		p.nextToken()
+		if p.peekTokenIs(token.IF) {
+			p.nextToken()
+			ie.Alternative = p.parseElseIf()
+			if ie.Alternative == nil {
+				return nil
+			}
+			return ie
+		}
 		if !p.expectPeek(token.LBRACE) {
-			p.errors = append(p.errors, "expected '{'")
 			return nil
 		}
 		ie.Alternative = p.parseBlockStatement()
@@ -333,20 +676,206 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return ie
 }
 
+// parseElseIf wraps the `if` that follows an `else` in a block so that
+// else-if chains need no special handling after parsing.
+func (p *Parser) parseElseIf() *ast.BlockStatement {
+	tok := p.curToken
+	alternative := p.parseIfExpression()
+	if alternative == nil {
+		return nil
+	}
+	return &ast.BlockStatement{
+		Token: tok,
+		Statements: []ast.Statement{
+			&ast.ExpressionStatement{Token: tok, Expression: alternative},
+		},
+	}
+}
+
+func (p *Parser) parseTryExpression() ast.Expression {
+	te := &ast.TryExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	te.Block = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+		if !p.expectPeek(token.LPAREN) {
+			return nil
+		}
+		if !p.expectPeek(token.IDENTIFIER) {
+			return nil
+		}
+		te.Parameter = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		te.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		te.Finally = p.parseBlockStatement()
+	}
+
+	if te.Catch == nil && te.Finally == nil {
+		p.newError(SyntaxError, te.Token, "try without catch or finally")
+		return nil
+	}
+	return te
+}
+
+func (p *Parser) parseMatchExpression() ast.Expression {
+	me := &ast.MatchExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	me.Subject = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		arm := p.parseMatchArm()
+		if arm == nil {
+			return nil
+		}
+		me.Arms = append(me.Arms, arm)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	me.Rbrace = p.curToken.Pos
+
+	return me
+}
+
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	arm := &ast.MatchArm{}
+
+	pattern := p.parsePattern()
+	if pattern == nil {
+		return nil
+	}
+	arm.Patterns = append(arm.Patterns, pattern)
+
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		pattern := p.parsePattern()
+		if pattern == nil {
+			return nil
+		}
+		arm.Patterns = append(arm.Patterns, pattern)
+	}
+
+	if !p.expectPeek(token.FAT_ARROW) {
+		return nil
+	}
+
+	if p.peekTokenIs(token.LBRACE) {
+		p.nextToken()
+		arm.Body = p.parseBlockStatement()
+		return arm
+	}
+
+	p.nextToken()
+	tok := p.curToken
+	body := p.parseExpression(LOWEST)
+	if body == nil {
+		return nil
+	}
+	arm.Body = &ast.BlockStatement{
+		Token: tok,
+		Statements: []ast.Statement{
+			&ast.ExpressionStatement{Token: tok, Expression: body},
+		},
+	}
+	return arm
+}
+
+func (p *Parser) parsePattern() ast.Expression {
+	tok := p.curToken
+	pattern := p.parseExpression(LOWEST)
+	if pattern == nil {
+		return nil
+	}
+	if !isPattern(pattern) {
+		p.newError(SyntaxError, tok, "invalid pattern %s", pattern.String())
+		return nil
+	}
+	return pattern
+}
+
+func isPattern(expression ast.Expression) bool {
+	switch expression := expression.(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.Boolean:
+		return true
+	case *ast.Identifier:
+		return expression.Value == "_"
+	case *ast.PrefixExpression:
+		switch expression.Right.(type) {
+		case *ast.IntegerLiteral, *ast.FloatLiteral:
+			return expression.Operator == "-"
+		}
+		return false
+	case *ast.ArrayLiteral:
+		for _, element := range expression.Elements {
+			if !isPattern(element) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	bs := &ast.BlockStatement{
 		Token: p.curToken,
 	}
 	bs.Statements = []ast.Statement{}
+	p.blocks = append(p.blocks, p.braceDepth)
+	defer func() { p.blocks = p.blocks[:len(p.blocks)-1] }()
 	p.nextToken()
 
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
 		stmt := p.parseStatement()
-		if stmt != nil {
+		if p.panicking {
+			p.synchronize()
+			if p.curTokenIs(token.RBRACE) {
+				continue
+			}
+		} else if stmt != nil {
 			bs.Statements = append(bs.Statements, stmt)
 		}
 		p.nextToken()
 	}
+	if p.curTokenIs(token.RBRACE) {
+		bs.Rbrace = p.curToken.Pos
+	}
 	return bs
 }
 
@@ -356,52 +885,125 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	}
 
 	if !p.expectPeek(token.LPAREN) {
-		p.errors = append(p.errors, "expected '('")
 		return nil
 	}
 
-	fl.Parameters = p.parseFunctionParemeters()
+	if !p.parseFunctionParemeters(fl) {
+		return nil
+	}
 
 	if !p.expectPeek(token.LBRACE) {
-		p.errors = append(p.errors, "expected '{'")
 		return nil
 	}
 
+	// break and continue never cross a function boundary.
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
 	fl.Body = p.parseBlockStatement()
+	p.loopDepth = loopDepth
+	markTailCalls(fl.Body, true)
 	return fl
 }
 
-func (p *Parser) parseFunctionParemeters() []*ast.Identifier {
-	identifiers := []*ast.Identifier{}
+// parseMacroLiteral parses a macro, whose parameters are plain identifiers.
+// Its body is not marked for tail calls because macros are not called like
+// functions.
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	ml := &ast.MacroLiteral{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	fl := &ast.FunctionLiteral{}
+	if !p.parseFunctionParemeters(fl) {
+		return nil
+	}
+	if fl.Rest != nil {
+		p.newError(SyntaxError, ml.Token, "macro parameters must be plain identifiers")
+		return nil
+	}
+	ml.Parameters = []*ast.Identifier{}
+	for _, param := range fl.Parameters {
+		if param.Name == nil || param.Default != nil {
+			p.newError(SyntaxError, ml.Token, "macro parameters must be plain identifiers")
+			return nil
+		}
+		ml.Parameters = append(ml.Parameters, param.Name)
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
+	ml.Body = p.parseBlockStatement()
+	p.loopDepth = loopDepth
+	return ml
+}
+
+func (p *Parser) parseFunctionParemeters(fl *ast.FunctionLiteral) bool {
+	fl.Parameters = []*ast.Parameter{}
 
 	if p.peekTokenIs(token.RPAREN) {
 		p.nextToken()
-		return identifiers
+		return true
 	}
 
-	p.nextToken()
-	identifier := &ast.Identifier{
-		Token: p.curToken,
-		Value: p.curToken.Literal,
+	if !p.parseFunctionParameter(fl) {
+		return false
 	}
-	identifiers = append(identifiers, identifier)
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
+		if !p.parseFunctionParameter(fl) {
+			return false
+		}
+	}
+
+	return p.expectPeek(token.RPAREN)
+}
+
+func (p *Parser) parseFunctionParameter(fl *ast.FunctionLiteral) bool {
+	if p.peekTokenIs(token.ELLIPSIS) {
 		p.nextToken()
-		identifier := &ast.Identifier{
-			Token: p.curToken,
-			Value: p.curToken.Literal,
+		if !p.expectPeek(token.IDENTIFIER) {
+			return false
 		}
-		identifiers = append(identifiers, identifier)
+		fl.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if p.peekTokenIs(token.COMMA) {
+			p.newError(SyntaxError, p.peekToken, "rest parameter %s must be the last parameter", fl.Rest.Value)
+			return false
+		}
+		return true
 	}
 
-	if !p.expectPeek(token.RPAREN) {
-		p.errors = append(p.errors, "expected ')'")
-		return nil
+	target := p.parseBindingTarget()
+	if target == nil {
+		return false
+	}
+	param := &ast.Parameter{}
+	if name, ok := target.(*ast.Identifier); ok {
+		param.Name = name
+	} else {
+		param.Pattern = target
+	}
+	hasDefaults := len(fl.Parameters) > 0 && fl.Parameters[len(fl.Parameters)-1].Default != nil
+	fl.Parameters = append(fl.Parameters, param)
+
+	if !p.peekTokenIs(token.ASSIGN) {
+		if hasDefaults {
+			p.newError(SyntaxError, p.curToken, "parameter %s without a default value follows parameters with defaults", target.String())
+			return false
+		}
+		return true
 	}
 
-	return identifiers
+	p.nextToken()
+	p.nextToken()
+	param.Default = p.parseExpression(LOWEST)
+	return param.Default != nil
 }
 
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
@@ -411,6 +1013,9 @@ func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	}
 
 	ce.Arguments = p.parseExpressionList(token.RPAREN)
+	if p.curTokenIs(token.RPAREN) {
+		ce.Rparen = p.curToken.Pos
+	}
 	return ce
 }
 
@@ -423,24 +1028,33 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	}
 
 	p.nextToken()
-	element := p.parseExpression(LOWEST)
+	element := p.parseListElement()
 	elements = append(elements, element)
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
-		argument := p.parseExpression(LOWEST)
+		argument := p.parseListElement()
 		elements = append(elements, argument)
 	}
 
 	if !p.expectPeek(end) {
-		p.errors = append(p.errors, fmt.Sprintf("expected '%s'", end))
 		return nil
 	}
 
 	return elements
 }
 
+func (p *Parser) parseListElement() ast.Expression {
+	if !p.curTokenIs(token.ELLIPSIS) {
+		return p.parseExpression(LOWEST)
+	}
+	spread := &ast.SpreadExpression{Token: p.curToken}
+	p.nextToken()
+	spread.Value = p.parseExpression(LOWEST)
+	return spread
+}
+
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	ie := &ast.IndexExpression{Token: p.curToken, Left: left}
 
@@ -451,5 +1065,35 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
+	ie.Rbracket = p.curToken.Pos
 	return ie
 }
+
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.curToken}
+	hash.Pairs = []*ast.HashPair{}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		key := p.parseExpression(LOWEST)
+
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+		hash.Pairs = append(hash.Pairs, &ast.HashPair{Key: key, Value: value})
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	hash.Rbrace = p.curToken.Pos
+
+	return hash
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"monkey/ast"
 	"monkey/lexer"
+	"monkey/token"
+	"strings"
 	"testing"
 )
 
@@ -37,6 +39,54 @@ func TestParseProgram(t *testing.T) {
 	}
 }
 
+func TestParsingWithComments(t *testing.T) {
+	input := `// leading
+let x = 1; // after x
+/* before
+   y */ let y = fn(a /* a */, b) { a + b }; x // trailing`
+
+	l := lexer.NewWithComments(input)
+	p := New(l)
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	checkProgram(t, program, 3)
+	if !testLetStatement(t, program.Statements[0], "x") {
+		return
+	}
+	if !testLetStatement(t, program.Statements[1], "y") {
+		return
+	}
+	stmt, ok := program.Statements[2].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Expected ExpressionStatement, got %T", program.Statements[2])
+	}
+	testIdentifier(t, stmt.Expression, "x")
+
+	expected := []struct {
+		text string
+		pos  string
+	}{
+		{"// leading", "1:1"},
+		{"// after x", "2:12"},
+		{"/* before\n   y */", "3:1"},
+		{"/* a */", "4:22"},
+		{"// trailing", "4:47"},
+	}
+	if len(program.Comments) != len(expected) {
+		t.Fatalf("Expected %d comments, got %d", len(expected), len(program.Comments))
+	}
+	for i, comment := range program.Comments {
+		if comment.String() != expected[i].text {
+			t.Errorf("comment %d: expected %q, got %q", i, expected[i].text, comment.String())
+		}
+		if pos := comment.Pos().String(); pos != expected[i].pos {
+			t.Errorf("comment %d: expected position %s, got %s", i, expected[i].pos, pos)
+		}
+	}
+}
+
 func TestIdentifierExpression(t *testing.T) {
 	input := "foobar"
 
@@ -107,6 +157,42 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14", 3.14},
+		{"1e-9", 1e-9},
+		{"2.5E+3", 2500},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		checkProgram(t, program)
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("Expected ExpressionStatement, got %T", program.Statements[0])
+		}
+		literal, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("Expected FloatLiteral, got %T", stmt.Expression)
+		}
+		if literal.Value != test.expected {
+			t.Errorf("Expected '%g', got '%g'", test.expected, literal.Value)
+		}
+		if literal.TokenLiteral() != test.input {
+			t.Errorf("Expected '%s', got '%s'", test.input, literal.TokenLiteral())
+		}
+	}
+}
+
 func TestStringLiteralExpression(t *testing.T) {
 	input := `"hello world"`
 
@@ -186,6 +272,9 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 > 5", 5, ">", 5},
 		{"5 == 5", 5, "==", 5},
 		{"5 != 5", 5, "!=", 5},
+		{"5 <= 5", 5, "<=", 5},
+		{"5 >= 5", 5, ">=", 5},
+		{"5 % 5", 5, "%", 5},
 		{"true == true", true, "==", true},
 		{"true != false", true, "!=", false},
 		{"false == false", false, "==", false},
@@ -257,6 +346,21 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 		{"add(a + b + c * d / f + g)", "add((((a + b) + ((c * d) / f)) + g))"},
 		{"a * [1, 2, 3, 4][b * c] * d", "((a * ([1, 2, 3, 4][(b * c)])) * d)"},
 		{"add(a * b[2], b[1], 2 * [1, 2][1])", "add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))"},
+		{"a + b // c", "(a + b)"},
+		{"a /* b */ * c", "(a * c)"},
+		{"a % b * c", "((a % b) * c)"},
+		{"a + b % c", "(a + (b % c))"},
+		{"a <= b == c >= d", "((a <= b) == (c >= d))"},
+		{"a || b && c", "(a || (b && c))"},
+		{"a && b || c", "((a && b) || c)"},
+		{"a == b && c != d", "((a == b) && (c != d))"},
+		{"!a && b", "((!a) && b)"},
+		{"x = 1 + 2", "x = (1 + 2)"},
+		{"x = y = z", "x = y = z"},
+		{"x += y * 2", "x += (y * 2)"},
+		{"a[i] = b || c", "(a[i]) = (b || c)"},
+		{"h[\"k\"] -= 1", "(h[k]) -= 1"},
+		{"f(x = 1)", "f(x = 1)"},
 	}
 
 	for _, test := range tests {
@@ -273,6 +377,40 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 	}
 }
 
+func TestLogicalExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		operator string
+	}{
+		{"a && b", "&&"},
+		{"a || b", "||"},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		checkProgram(t, program)
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("Expected ExpressionStatement, got %T", program.Statements[0])
+		}
+		exp, ok := stmt.Expression.(*ast.LogicalExpression)
+		if !ok {
+			t.Fatalf("Expected LogicalExpression, got %T", stmt.Expression)
+		}
+		if exp.Operator != test.operator {
+			t.Errorf("Expected '%s', got '%s'", test.operator, exp.Operator)
+		}
+		testIdentifier(t, exp.Left, "a")
+		testIdentifier(t, exp.Right, "b")
+	}
+}
+
 func TestIfExpression(t *testing.T) {
 	input := `if (x < y) { x }`
 
@@ -381,8 +519,8 @@ func TestFunctionLiteralParsing(t *testing.T) {
 	if len(function.Parameters) != 2 {
 		t.Fatalf("Expected 2 params, got %d", len(function.Parameters))
 	}
-	testLiteralExpression(t, function.Parameters[0], "x")
-	testLiteralExpression(t, function.Parameters[1], "y")
+	testLiteralExpression(t, function.Parameters[0].Name, "x")
+	testLiteralExpression(t, function.Parameters[1].Name, "y")
 
 	if len(function.Body.Statements) != 1 {
 		t.Fatalf("Expected 1 statement, got %d", len(function.Body.Statements))
@@ -395,6 +533,42 @@ func TestFunctionLiteralParsing(t *testing.T) {
 	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
 }
 
+func TestMacroLiteralParsing(t *testing.T) {
+	input := `macro(x, y) { x + y; }`
+
+	l := lexer.New(input)
+	p := New(l)
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	checkProgram(t, program)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Expected ExpressionStatement, got %T", program.Statements[0])
+	}
+	macro, ok := stmt.Expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("Expected MacroLiteral, got %T", stmt.Expression)
+	}
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("Expected 2 params, got %d", len(macro.Parameters))
+	}
+	testLiteralExpression(t, macro.Parameters[0], "x")
+	testLiteralExpression(t, macro.Parameters[1], "y")
+
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("Expected 1 statement, got %d", len(macro.Body.Statements))
+	}
+
+	bodyStmt, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Expected ExpressionStatement, got %T", macro.Body.Statements[0])
+	}
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
 func TestFunctionParameterParsing(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -426,11 +600,336 @@ func TestFunctionParameterParsing(t *testing.T) {
 			t.Fatalf("Expected %d params, got %d", len(test.expected), len(function.Parameters))
 		}
 		for i, param := range test.expected {
-			testLiteralExpression(t, function.Parameters[i], param)
+			testLiteralExpression(t, function.Parameters[i].Name, param)
+		}
+	}
+}
+
+func TestFunctionDefaultParameterParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(a, b = 2) { a + b }", "fn(a, b = 2)(a + b)"},
+		{"fn(a = 1, b = a * 2) { a + b }", "fn(a = 1, b = (a * 2))(a + b)"},
+		{"let add = fn(a, b = 2) { a + b };", "let add = fn(a, b = 2)(a + b);"},
+		{"fn(first, ...rest) { rest }", "fn(first, ...rest)rest"},
+		{"fn(...all) { all }", "fn(...all)all"},
+		{"f(...xs)", "f(...xs)"},
+		{"f(1, ...xs, ...[2, 3])", "f(1, ...xs, ...[2, 3])"},
+		{"[0, ...xs]", "[0, ...xs]"},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		checkProgram(t, program)
+
+		if program.String() != test.expected {
+			t.Errorf("Expected '%s', got '%s'", test.expected, program.String())
+		}
+	}
+}
+
+func TestFunctionLiteralName(t *testing.T) {
+	input := "let myFunction = fn() { };"
+
+	l := lexer.New(input)
+	p := New(l)
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	checkProgram(t, program)
+
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("Expected LetStatement, got %T", program.Statements[0])
+	}
+	function, ok := stmt.Value.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("Expected FunctionLiteral, got %T", stmt.Value)
+	}
+	if function.Name != "myFunction" {
+		t.Errorf("Expected name 'myFunction', got '%s'", function.Name)
+	}
+}
+
+func TestElseIfExpression(t *testing.T) {
+	input := `if (x < y) { x } else if (x > y) { y } else { 0 }`
+
+	l := lexer.New(input)
+	p := New(l)
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	checkProgram(t, program)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Expected ExpressionStatement, got %T", program.Statements[0])
+	}
+	ie, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("Expected IfExpression, got %T", stmt.Expression)
+	}
+	if len(ie.Alternative.Statements) != 1 {
+		t.Fatalf("Expected 1 alternative statement, got %d", len(ie.Alternative.Statements))
+	}
+	alternative, ok := ie.Alternative.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Expected ExpressionStatement, got %T", ie.Alternative.Statements[0])
+	}
+	elseIf, ok := alternative.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("Expected IfExpression, got %T", alternative.Expression)
+	}
+	if !testInfixExpression(t, elseIf.Condition, "x", ">", "y") {
+		return
+	}
+	if elseIf.Alternative == nil {
+		t.Fatalf("Expected else branch on nested if")
+	}
+	if ie.End().Offset != len(input) {
+		t.Errorf("Expected if expression to end at %d, got %d", len(input), ie.End().Offset)
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	input := `match (x) { 1, 2 => "small", [_, -1.5] => { let y = 2; y }, "x" => true, _ => false, }`
+
+	l := lexer.New(input)
+	p := New(l)
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	checkProgram(t, program)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Expected ExpressionStatement, got %T", program.Statements[0])
+	}
+	me, ok := stmt.Expression.(*ast.MatchExpression)
+	if !ok {
+		t.Fatalf("Expected MatchExpression, got %T", stmt.Expression)
+	}
+	if !testIdentifier(t, me.Subject, "x") {
+		return
+	}
+
+	tests := []struct {
+		patterns   []string
+		statements int
+	}{
+		{[]string{"1", "2"}, 1},
+		{[]string{"[_, (-1.5)]"}, 2},
+		{[]string{"x"}, 1},
+		{[]string{"_"}, 1},
+	}
+
+	if len(me.Arms) != len(tests) {
+		t.Fatalf("Expected %d arms, got %d", len(tests), len(me.Arms))
+	}
+	for i, test := range tests {
+		arm := me.Arms[i]
+		if len(arm.Patterns) != len(test.patterns) {
+			t.Errorf("Arm %d: expected %d patterns, got %d", i, len(test.patterns), len(arm.Patterns))
+			continue
+		}
+		for j, pattern := range arm.Patterns {
+			if pattern.String() != test.patterns[j] {
+				t.Errorf("Arm %d: expected pattern %q, got %q", i, test.patterns[j], pattern.String())
+			}
+		}
+		if len(arm.Body.Statements) != test.statements {
+			t.Errorf("Arm %d: expected %d statements, got %d", i, test.statements, len(arm.Body.Statements))
+		}
+	}
+}
+
+func TestTryExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"try { f() } catch (e) { e }", "try f() catch (e) e"},
+		{"try { f() } finally { g() }", "try f() finally g()"},
+		{"let x = try { f() } catch (err) { 0 } finally { g() };", "let x = try f() catch (err) 0 finally g();"},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		checkProgram(t, program)
+
+		if program.String() != test.expected {
+			t.Errorf("Expected '%s', got '%s'", test.expected, program.String())
+		}
+	}
+}
+
+func TestTailCallMarking(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"fn() { f() }", []string{"f()"}},
+		{"fn() { f(); g() }", []string{"g()"}},
+		{"fn() { return f(); g() }", []string{"f()", "g()"}},
+		{"fn() { 1 + f() }", []string{}},
+		{"fn() { let x = f(); x }", []string{}},
+		{"fn() { if (a) { f() } else if (b) { g() } else { h(i()) } }", []string{"f()", "g()", "h(i())"}},
+		{"fn() { if (a) { return f(); } g(); 1 }", []string{"f()"}},
+		{"fn() { match (a) { 1 => f(), _ => { g() } } }", []string{"f()", "g()"}},
+		{"fn() { while (a) { f(); return g(); } }", []string{"g()"}},
+		{"fn() { try { f() } catch (e) { g() } }", []string{}},
+		{"fn() { fn() { f() } }", []string{"f()"}},
+		{"f()", []string{}},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		tail := []string{}
+		collectTailCalls(program, &tail)
+		if strings.Join(tail, " ") != strings.Join(test.expected, " ") {
+			t.Errorf("%q: expected tail calls %v, got %v", test.input, test.expected, tail)
 		}
 	}
 }
 
+// collectTailCalls gathers the calls marked as tail calls, walking just the
+// node types used in TestTailCallMarking.
+func collectTailCalls(node ast.Node, calls *[]string) {
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, stmt := range node.Statements {
+			collectTailCalls(stmt, calls)
+		}
+	case *ast.BlockStatement:
+		if node == nil {
+			return
+		}
+		for _, stmt := range node.Statements {
+			collectTailCalls(stmt, calls)
+		}
+	case *ast.ExpressionStatement:
+		collectTailCalls(node.Expression, calls)
+	case *ast.ReturnStatement:
+		collectTailCalls(node.ReturnValue, calls)
+	case *ast.LetStatement:
+		collectTailCalls(node.Value, calls)
+	case *ast.WhileStatement:
+		collectTailCalls(node.Body, calls)
+	case *ast.FunctionLiteral:
+		collectTailCalls(node.Body, calls)
+	case *ast.IfExpression:
+		collectTailCalls(node.Consequence, calls)
+		collectTailCalls(node.Alternative, calls)
+	case *ast.MatchExpression:
+		for _, arm := range node.Arms {
+			collectTailCalls(arm.Body, calls)
+		}
+	case *ast.TryExpression:
+		collectTailCalls(node.Block, calls)
+		collectTailCalls(node.Catch, calls)
+	case *ast.InfixExpression:
+		collectTailCalls(node.Left, calls)
+		collectTailCalls(node.Right, calls)
+	case *ast.CallExpression:
+		if node.Tail {
+			*calls = append(*calls, node.String())
+		}
+		for _, arg := range node.Arguments {
+			collectTailCalls(arg, calls)
+		}
+	}
+}
+
+func TestWhileStatement(t *testing.T) {
+	input := `while (x < 10) { x += 1; }`
+
+	l := lexer.New(input)
+	p := New(l)
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	checkProgram(t, program)
+
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("Expected WhileStatement, got %T", program.Statements[0])
+	}
+	if !testInfixExpression(t, stmt.Condition, "x", "<", 10) {
+		return
+	}
+	if len(stmt.Body.Statements) != 1 {
+		t.Fatalf("Expected 1 statement, got %d", len(stmt.Body.Statements))
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	input := `for (item in items) { if (item) { continue; } break; }`
+
+	l := lexer.New(input)
+	p := New(l)
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	checkProgram(t, program)
+
+	stmt, ok := program.Statements[0].(*ast.ForStatement)
+	if !ok {
+		t.Fatalf("Expected ForStatement, got %T", program.Statements[0])
+	}
+	if !testIdentifier(t, stmt.Variable, "item") {
+		return
+	}
+	if !testIdentifier(t, stmt.Iterable, "items") {
+		return
+	}
+	if len(stmt.Body.Statements) != 2 {
+		t.Fatalf("Expected 2 statements, got %d", len(stmt.Body.Statements))
+	}
+	if _, ok := stmt.Body.Statements[1].(*ast.BreakStatement); !ok {
+		t.Fatalf("Expected BreakStatement, got %T", stmt.Body.Statements[1])
+	}
+}
+
+func TestLoopStatementsWithSemicolons(t *testing.T) {
+	tests := []string{
+		`let i = 0; while (i < 5) { i += 1 }; i`,
+		`let n = 0; for (x in [1, 2]) { n += x }; n`,
+		`while (false) {}; for (x in []) {}; 1`,
+	}
+
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := New(l)
+
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		checkProgram(t, program, 3)
+	}
+}
+
 func TestCallExpressionParsing(t *testing.T) {
 	input := `add(1, 2 * 3, 4 + 5)`
 
@@ -494,6 +993,74 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestDestructuringParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let [a, b] = xs;", "let [a, b] = xs;"},
+		{"let [a, ...tail] = xs;", "let [a, ...tail] = xs;"},
+		{"let [[a, b], c] = xs;", "let [[a, b], c] = xs;"},
+		{"let [] = xs;", "let [] = xs;"},
+		{"let {name, age} = person;", "let {name, age} = person;"},
+		{"let [{name}, ...others] = people;", "let [{name}, ...others] = people;"},
+		{"fn([a, b], {c}) { a }", "fn([a, b], {c})a"},
+		{"fn([a, b] = [1, 2]) { a }", "fn([a, b] = [1, 2])a"},
+		{"fn([a], [a] = [a]) { a }", "fn([a], [a] = [a])a"},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		checkProgram(t, program)
+
+		if program.String() != test.expected {
+			t.Errorf("Expected '%s', got '%s'", test.expected, program.String())
+		}
+	}
+}
+
+func TestPatternParameterParsing(t *testing.T) {
+	input := `fn(x, [a, b], {c} = {"c": 1}) { a }`
+
+	l := lexer.New(input)
+	p := New(l)
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	checkProgram(t, program)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	function, ok := stmt.Expression.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("Expected FunctionLiteral, got %T", stmt.Expression)
+	}
+	if len(function.Parameters) != 3 {
+		t.Fatalf("Expected 3 params, got %d", len(function.Parameters))
+	}
+
+	x := function.Parameters[0]
+	if !testIdentifier(t, x.Name, "x") || x.Pattern != nil || x.Default != nil {
+		t.Errorf("Expected plain parameter x, got %+v", x)
+	}
+	ab := function.Parameters[1]
+	if _, ok := ab.Pattern.(*ast.ArrayPattern); !ok || ab.Name != nil {
+		t.Errorf("Expected ArrayPattern parameter, got %+v", ab)
+	}
+	c := function.Parameters[2]
+	if _, ok := c.Pattern.(*ast.HashPattern); !ok || c.Name != nil {
+		t.Errorf("Expected HashPattern parameter, got %+v", c)
+	}
+	if _, ok := c.Default.(*ast.HashLiteral); !ok {
+		t.Errorf("Expected HashLiteral default, got %T", c.Default)
+	}
+}
+
 func TestParsingArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 
@@ -548,6 +1115,310 @@ func TestParsingIndexExpression(t *testing.T) {
 	}
 }
 
+func TestParsingHashLiteralsStringKeys(t *testing.T) {
+	input := `{"one": 1, "two": 2, "three": 3}`
+
+	l := lexer.New(input)
+	p := New(l)
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	checkProgram(t, program)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Expected ExpressionStatement, got %T", program.Statements[0])
+	}
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("Expected HashLiteral, got %T", stmt.Expression)
+	}
+	if len(hash.Pairs) != 3 {
+		t.Fatalf("Expected 3 pairs, got %d", len(hash.Pairs))
+	}
+
+	expected := []struct {
+		key   string
+		value int64
+	}{
+		{"one", 1},
+		{"two", 2},
+		{"three", 3},
+	}
+	for i, pair := range hash.Pairs {
+		literal, ok := pair.Key.(*ast.StringLiteral)
+		if !ok {
+			t.Errorf("Expected StringLiteral key, got %T", pair.Key)
+			continue
+		}
+		if literal.String() != expected[i].key {
+			t.Errorf("Expected key %d to be %q, got %q", i, expected[i].key, literal.String())
+		}
+		testIntegerLiteralExpression(t, pair.Value, expected[i].value)
+	}
+}
+
+func TestParsingEmptyHashLiteral(t *testing.T) {
+	input := "{}"
+
+	l := lexer.New(input)
+	p := New(l)
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	checkProgram(t, program)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Expected ExpressionStatement, got %T", program.Statements[0])
+	}
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("Expected HashLiteral, got %T", stmt.Expression)
+	}
+	if len(hash.Pairs) != 0 {
+		t.Fatalf("Expected 0 pairs, got %d", len(hash.Pairs))
+	}
+}
+
+func TestParsingHashLiteralsWithExpressions(t *testing.T) {
+	input := `{"one": 0 + 1, "two": 10 - 8, "three": 15 / 5}`
+
+	l := lexer.New(input)
+	p := New(l)
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	checkProgram(t, program)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Expected ExpressionStatement, got %T", program.Statements[0])
+	}
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("Expected HashLiteral, got %T", stmt.Expression)
+	}
+	if len(hash.Pairs) != 3 {
+		t.Fatalf("Expected 3 pairs, got %d", len(hash.Pairs))
+	}
+
+	tests := map[string]func(ast.Expression){
+		"one": func(e ast.Expression) {
+			testInfixExpression(t, e, 0, "+", 1)
+		},
+		"two": func(e ast.Expression) {
+			testInfixExpression(t, e, 10, "-", 8)
+		},
+		"three": func(e ast.Expression) {
+			testInfixExpression(t, e, 15, "/", 5)
+		},
+	}
+	for _, pair := range hash.Pairs {
+		literal, ok := pair.Key.(*ast.StringLiteral)
+		if !ok {
+			t.Errorf("Expected StringLiteral key, got %T", pair.Key)
+			continue
+		}
+		testFunc, ok := tests[literal.String()]
+		if !ok {
+			t.Errorf("No test function for key %q found", literal.String())
+			continue
+		}
+		testFunc(pair.Value)
+	}
+}
+
+func TestNodePositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"foobar", "1:1-1:7"},
+		{"1 + 22", "1:1-1:7"},
+		{"-a * b", "1:1-1:7"},
+		{"add(1, 2)", "1:1-1:10"},
+		{"[1, 2][0]", "1:1-1:10"},
+		{`{"a": 1}`, "1:1-1:9"},
+		{"let x = 5;", "1:1-1:10"},
+		{"return 5;", "1:1-1:9"},
+		{"if (x) {\n  y\n} else { z }", "1:1-3:13"},
+		{"fn(x) {\n  x\n}", "1:1-3:2"},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		checkProgram(t, program)
+
+		stmt := program.Statements[0]
+		actual := fmt.Sprintf("%s-%s", stmt.Pos(), stmt.End())
+		if actual != test.expected {
+			t.Errorf("%q: Expected position %s, got %s", test.input, test.expected, actual)
+		}
+	}
+}
+
+func TestParserErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let = 5;", "1:5: Expected IDENTIFIER, got ="},
+		{"let x = 5;\nadd(1, 2", "2:9: Expected ), got EOF"},
+		{"fn(a = 1, b) { }", "1:11: parameter b without a default value follows parameters with defaults"},
+		{"fn(...rest, a) { }", "1:11: rest parameter rest must be the last parameter"},
+		{"1 = 2", "1:3: cannot assign to 1"},
+		{"break;", "1:1: break outside of a loop"},
+		{"while (true) { fn() { continue; } }", "1:23: continue outside of a loop"},
+		{"for (x of xs) { }", "1:8: Expected IN, got IDENTIFIER"},
+		{"f() += 2", "1:5: cannot assign to f()"},
+		{`let s = "abc`, "1:9: unterminated string literal"},
+		{`add(1 @`, "1:7: illegal character '@'"},
+		{"let [a, ...b, c] = xs;", "1:13: rest element b must be the last element"},
+		{"let {a, 1} = h;", "1:9: Expected IDENTIFIER, got INT"},
+		{"let [a, 1] = xs;", "1:9: Expected IDENTIFIER, got INT"},
+		{"fn([a b]) { }", "1:7: Expected ,, got IDENTIFIER"},
+		{"try { 1 }", "1:1: try without catch or finally"},
+		{"try { 1 } catch { 2 }", "1:17: Expected (, got {"},
+		{"try { 1 } catch (1) { 2 }", "1:18: Expected IDENTIFIER, got INT"},
+		{"match (x) { y => 1 }", "1:13: invalid pattern y"},
+		{"match (x) { [1, a + 1] => 1 }", "1:13: invalid pattern [1, (a + 1)]"},
+		{"match (x) { 1 => 2 3 => 4 }", "1:20: Expected ,, got INT"},
+		{"if (x) { 1 } else if { 2 }", "1:22: Expected (, got {"},
+		{"macro(a, b = 1) { a }", "1:1: macro parameters must be plain identifiers"},
+		{"macro(...a) { a }", "1:1: macro parameters must be plain identifiers"},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("%q: Expected parser errors, got none", test.input)
+		}
+		if errors[0] != test.expected {
+			t.Errorf("%q: Expected error %q, got %q", test.input, test.expected, errors[0])
+		}
+	}
+}
+
+func TestParseErrorDetails(t *testing.T) {
+	input := "let x = 5;\n\tadd(1, 2"
+
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.ParseErrors()
+	if len(errors) == 0 {
+		t.Fatalf("Expected parser errors, got none")
+	}
+	err := errors[0]
+	if err.Kind != UnexpectedToken {
+		t.Errorf("Expected kind %s, got %s", UnexpectedToken, err.Kind)
+	}
+	if err.Expected != token.RPAREN {
+		t.Errorf("Expected expected token %s, got %s", token.RPAREN, err.Expected)
+	}
+	if err.Actual.Type != token.EOF {
+		t.Errorf("Expected actual token %s, got %s", token.EOF, err.Actual.Type)
+	}
+
+	expected := "2:10: Expected ), got EOF\n\t\tadd(1, 2\n\t\t        ^"
+	if err.Snippet() != expected {
+		t.Errorf("Expected snippet %q, got %q", expected, err.Snippet())
+	}
+}
+
+func TestParserErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedErrors []string
+		expected       string
+	}{
+		{
+			"let = 5; let y = 10; y;",
+			[]string{"1:5: Expected IDENTIFIER, got ="},
+			"let y = 10;y",
+		},
+		{
+			"let x = add(1, ; let y = 2;",
+			[]string{"1:16: no prefix parse function for ;"},
+			"let y = 2;",
+		},
+		{
+			"let f = fn(x, 1) { x }; f(2);",
+			[]string{"1:15: Expected IDENTIFIER, got INT"},
+			"f(2)",
+		},
+		{
+			"let f = fn() { let = 1; 2 + }; f();",
+			[]string{"1:20: Expected IDENTIFIER, got =", "1:29: no prefix parse function for }"},
+			"let f = fn();f()",
+		},
+		{
+			"if (x { 1 } let y = 2; y",
+			[]string{"1:7: Expected ), got {"},
+			"let y = 2;y",
+		},
+		{
+			"1 +",
+			[]string{"1:4: no prefix parse function for EOF"},
+			"",
+		},
+		{
+			`let h = {"a" 1}; 2`,
+			[]string{"1:14: Expected :, got INT"},
+			"2",
+		},
+		{
+			"match (1) { 1 => 2 3 => 4 }; 5",
+			[]string{"1:20: Expected ,, got INT"},
+			"5",
+		},
+		{
+			`let f = fn() { let h = {"a" 1}; 2 }; f()`,
+			[]string{"1:29: Expected :, got INT"},
+			"let f = fn()2;f()",
+		},
+		{
+			"let f = fn() { match (1) { 1 => 2 3 => 4 }; 5 }; f()",
+			[]string{"1:35: Expected ,, got INT"},
+			"let f = fn()5;f()",
+		},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != len(test.expectedErrors) {
+			t.Errorf("%q: Expected %d errors, got %d: %q", test.input, len(test.expectedErrors), len(errors), errors)
+			continue
+		}
+		for i, expected := range test.expectedErrors {
+			if errors[i] != expected {
+				t.Errorf("%q: Expected error %q, got %q", test.input, expected, errors[i])
+			}
+		}
+		if program.String() != test.expected {
+			t.Errorf("%q: Expected program %q, got %q", test.input, test.expected, program.String())
+		}
+	}
+}
+
 func testIntegerLiteralExpression(test *testing.T, expr ast.Expression, value int64) bool {
 	il, ok := expr.(*ast.IntegerLiteral)
 	if !ok {
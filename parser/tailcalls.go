@@ -0,0 +1,41 @@
+package parser
+
+import "monkey/ast"
+
+// markTailCalls flags the calls whose result is returned from the function
+// unchanged: the operand of a return statement and the value of the last
+// statement of a block that is itself in tail position. Nested function
+// literals are marked when they are parsed, and calls inside a try block
+// are never in tail position because the try has to observe their errors.
+func markTailCalls(block *ast.BlockStatement, tail bool) {
+	if block == nil {
+		return
+	}
+	for i, stmt := range block.Statements {
+		last := tail && i == len(block.Statements)-1
+		switch stmt := stmt.(type) {
+		case *ast.ReturnStatement:
+			markTailExpression(stmt.ReturnValue, true)
+		case *ast.ExpressionStatement:
+			markTailExpression(stmt.Expression, last)
+		case *ast.WhileStatement:
+			markTailCalls(stmt.Body, false)
+		case *ast.ForStatement:
+			markTailCalls(stmt.Body, false)
+		}
+	}
+}
+
+func markTailExpression(expression ast.Expression, tail bool) {
+	switch expression := expression.(type) {
+	case *ast.CallExpression:
+		expression.Tail = tail
+	case *ast.IfExpression:
+		markTailCalls(expression.Consequence, tail)
+		markTailCalls(expression.Alternative, tail)
+	case *ast.MatchExpression:
+		for _, arm := range expression.Arms {
+			markTailCalls(arm.Body, tail)
+		}
+	}
+}
@@ -15,6 +15,7 @@ const PROMPT = ">> "
 func Start(in io.Reader, out io.Writer) {
 	scanner := bufio.NewScanner(in)
 	env := object.NewEnvironment()
+	macroEnv := object.NewEnvironment()
 
 	for {
 		fmt.Printf(PROMPT)
@@ -27,20 +28,35 @@ func Start(in io.Reader, out io.Writer) {
 		l := lexer.New(line)
 		p := parser.New(l)
 		program := p.ParseProgram()
-		if len(p.Errors()) > 0 {
-			printParserErrors(out, p.Errors())
+		if len(p.ParseErrors()) > 0 {
+			printParserErrors(out, p.ParseErrors())
 			continue
 		}
-		evaluated := evaluator.Eval(program, env)
+		if len(program.Statements) == 0 {
+			continue
+		}
+		evaluator.DefineMacros(program, macroEnv)
+		expanded, err := evaluator.ExpandMacros(program, macroEnv)
+		var evaluated object.Object
+		if err != nil {
+			evaluated = err
+		} else {
+			evaluated = evaluator.Eval(expanded, env)
+		}
 		if evaluated != nil {
 			io.WriteString(out, evaluated.Inspect())
 			io.WriteString(out, "\n")
 		}
+		if err, ok := evaluated.(*object.Error); ok {
+			for _, line := range err.Traceback() {
+				io.WriteString(out, "\t"+line+"\n")
+			}
+		}
 	}
 }
 
-func printParserErrors(out io.Writer, errors []string) {
-	for _, message := range errors {
-		io.WriteString(out, "\t"+message+"\n")
+func printParserErrors(out io.Writer, errors []*parser.ParseError) {
+	for _, err := range errors {
+		io.WriteString(out, err.Snippet()+"\n")
 	}
 }
@@ -1,36 +1,77 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
+// Position locates a single byte of the source. Line and Column are
+// 1-based, Offset is the 0-based byte offset into the input.
+type Position struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Position) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Token is a lexed token. Pos is the position of its first character and
+// End the position immediately after its last one.
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position
+	End     Position
 }
 
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
+	COMMENT = "COMMENT"
 
 	// Identifiers + literals
 	IDENTIFIER = "IDENTIFIER"
 	INT        = "INT"
+	FLOAT      = "FLOAT"
 
 	// Operators
-	ASSIGN   = "="
+	ASSIGN          = "="
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
+
 	PLUS     = "+"
 	MINUS    = "-"
 	BANG     = "!"
 	ASTERISK = "*"
 	SLASH    = "/"
+	PERCENT  = "%"
 
 	LT     = "<"
 	GT     = ">"
+	LT_EQ  = "<="
+	GT_EQ  = ">="
 	EQ     = "=="
 	NOT_EQ = "!="
 
+	AND = "&&"
+	OR  = "||"
+
 	// Delimiters
 	COMMA     = ","
 	SEMICOLON = ";"
+	COLON     = ":"
+	ELLIPSIS  = "..."
+	FAT_ARROW = "=>"
 
 	LPAREN   = "("
 	RPAREN   = ")"
@@ -45,6 +86,16 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	WHILE    = "WHILE"
+	FOR      = "FOR"
+	IN       = "IN"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
+	MATCH    = "MATCH"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
+	MACRO    = "MACRO"
 	TRUE     = "TRUE"
 	FALSE    = "FALSE"
 	STRING   = "STRING"
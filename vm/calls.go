@@ -0,0 +1,203 @@
+package vm
+
+import (
+	"monkey/evaluator"
+	"monkey/object"
+)
+
+// callFunction calls the function below the numArgs arguments on top of
+// the stack. A tail call replaces the current frame instead of pushing a
+// new one.
+func (vm *VM) callFunction(numArgs int, tail bool) *object.Error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	frame := vm.currentFrame()
+	callSite := frame.pos()
+
+	if !tail {
+		if max := vm.options.CallDepthLimit(); max > 0 && len(vm.frames)-1 >= max {
+			return newError("maximum call depth of %d exceeded", max)
+		}
+	}
+
+	switch callee := callee.(type) {
+	case *object.Closure:
+		fn := callee.Fn
+		if numArgs < fn.NumParameters-fn.NumDefaults || (!fn.HasRest && numArgs > fn.NumParameters) {
+			err := evaluator.ArityError(fn.Name, numArgs, fn.NumParameters, fn.NumDefaults, fn.HasRest)
+			return vm.callFailed(err, tail)
+		}
+
+		basePointer := vm.sp - numArgs
+		if tail {
+			// Move the callee and its arguments over the current frame.
+			vm.closeUpvalues(frame.basePointer)
+			copy(vm.stack[frame.basePointer-1:], vm.stack[basePointer-1:vm.sp])
+			basePointer = frame.basePointer
+			vm.frames = vm.frames[:len(vm.frames)-1]
+		}
+		vm.frames = append(vm.frames, NewFrame(callee, basePointer, numArgs, callSite))
+		vm.bindArguments(callee.Fn, basePointer, numArgs)
+		return nil
+
+	case *object.Builtin:
+		args := make([]object.Object, numArgs)
+		copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+		vm.sp -= numArgs + 1
+
+		result := callee.Fn(args...)
+		if err, ok := result.(*object.Error); ok {
+			return vm.callFailed(err, tail)
+		}
+		if tail {
+			vm.popFrame()
+		}
+		vm.push(result)
+		return nil
+
+	default:
+		return vm.callFailed(newError("not a function: %s", callee.Type()), tail)
+	}
+}
+
+// callFailed returns err for a call that could not be made. A failed tail
+// call fails the calling function as if it had made the call after
+// returning, so its frame is not part of the stack trace.
+func (vm *VM) callFailed(err *object.Error, tail bool) *object.Error {
+	if !tail {
+		return err
+	}
+	if !err.Pos.IsValid() {
+		err.Pos = vm.currentFrame().pos()
+	}
+	vm.popFrame()
+	return err
+}
+
+// bindArguments sets up the local slots of a function called with numArgs
+// arguments starting at basePointer.
+func (vm *VM) bindArguments(fn *object.CompiledFunction, basePointer, numArgs int) {
+	vm.ensureStack(basePointer + fn.NumLocals + 1)
+
+	var rest *object.Array
+	if fn.HasRest {
+		rest = &object.Array{Elements: []object.Object{}}
+		if numArgs > fn.NumParameters {
+			rest.Elements = append(rest.Elements, vm.stack[basePointer+fn.NumParameters:basePointer+numArgs]...)
+			numArgs = fn.NumParameters
+		}
+	}
+
+	// Missing parameters and the other locals start out undefined.
+	for i := basePointer + numArgs; i < basePointer+fn.NumLocals; i++ {
+		vm.stack[i] = nil
+	}
+	if rest != nil {
+		vm.stack[basePointer+fn.NumParameters] = rest
+	}
+	vm.sp = basePointer + fn.NumLocals
+}
+
+// popFrame leaves the current frame, removing the function and its locals
+// from the stack.
+func (vm *VM) popFrame() {
+	frame := vm.currentFrame()
+	vm.closeUpvalues(frame.basePointer)
+	vm.frames = vm.frames[:len(vm.frames)-1]
+	vm.sp = frame.basePointer - 1
+}
+
+// raise unwinds the stack to the innermost try block and continues with
+// its catch code, recording the frames it leaves on err. It reports false
+// when no try block is left, which ends the program with err.
+func (vm *VM) raise(err *object.Error) bool {
+	frame := vm.currentFrame()
+	if !err.Pos.IsValid() {
+		err.Pos = frame.pos()
+		if !err.Pos.IsValid() {
+			err.Pos = frame.callSite
+		}
+	}
+
+	for {
+		frameIndex := len(vm.frames) - 1
+		if n := len(vm.handlers); n > 0 && vm.handlers[n-1].frame == frameIndex {
+			h := vm.handlers[n-1]
+			vm.handlers = vm.handlers[:n-1]
+			vm.sp = h.sp
+			vm.push(err)
+			frame.ip = h.catchIP
+			return true
+		}
+		if frameIndex == 0 {
+			return false
+		}
+
+		// Errors binding arguments are reported at the call site only.
+		if !frame.inPrologue() {
+			err.AddFrame(object.Frame{Function: frame.cl.Fn.Name, Pos: frame.callSite}, evaluator.MaxStackFrames)
+		}
+		vm.popFrame()
+		frame = vm.currentFrame()
+	}
+}
+
+// captureUpvalue returns the upvalue for a stack slot, sharing it with
+// the closures that already captured the slot.
+func (vm *VM) captureUpvalue(slot int) *object.Upvalue {
+	i := len(vm.openUpvalues)
+	for i > 0 && vm.openUpvalues[i-1].Slot >= slot {
+		if vm.openUpvalues[i-1].Slot == slot {
+			return vm.openUpvalues[i-1]
+		}
+		i--
+	}
+
+	upvalue := &object.Upvalue{Slot: slot, Open: true}
+	vm.openUpvalues = append(vm.openUpvalues, nil)
+	copy(vm.openUpvalues[i+1:], vm.openUpvalues[i:])
+	vm.openUpvalues[i] = upvalue
+	return upvalue
+}
+
+// closeUpvalues moves the variables in the slots from slot upwards out of
+// the stack and into their upvalues.
+func (vm *VM) closeUpvalues(slot int) {
+	n := len(vm.openUpvalues)
+	for n > 0 && vm.openUpvalues[n-1].Slot >= slot {
+		upvalue := vm.openUpvalues[n-1]
+		upvalue.Value = vm.stack[upvalue.Slot]
+		upvalue.Open = false
+		n--
+	}
+	vm.openUpvalues = vm.openUpvalues[:n]
+}
+
+// closeUpvalueRange closes the open upvalues of the count slots from slot
+// on, leaving those of other slots open.
+func (vm *VM) closeUpvalueRange(slot, count int) {
+	open := vm.openUpvalues[:0]
+	for _, upvalue := range vm.openUpvalues {
+		if upvalue.Slot >= slot && upvalue.Slot < slot+count {
+			upvalue.Value = vm.stack[upvalue.Slot]
+			upvalue.Open = false
+			continue
+		}
+		open = append(open, upvalue)
+	}
+	vm.openUpvalues = open
+}
+
+func (vm *VM) upvalue(u *object.Upvalue) object.Object {
+	if u.Open {
+		return vm.stack[u.Slot]
+	}
+	return u.Value
+}
+
+func (vm *VM) setUpvalue(u *object.Upvalue, value object.Object) {
+	if u.Open {
+		vm.stack[u.Slot] = value
+		return
+	}
+	u.Value = value
+}
@@ -0,0 +1,33 @@
+package vm
+
+import (
+	"monkey/code"
+	"monkey/object"
+	"monkey/token"
+)
+
+type Frame struct {
+	cl          *object.Closure
+	ip          int // offset of the next instruction
+	basePointer int
+	argc        int            // number of arguments passed
+	callSite    token.Position // position of the call that created the frame
+}
+
+func NewFrame(cl *object.Closure, basePointer, argc int, callSite token.Position) *Frame {
+	return &Frame{cl: cl, basePointer: basePointer, argc: argc, callSite: callSite}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
+
+// pos returns the source position of the instruction being executed.
+func (f *Frame) pos() token.Position {
+	return f.cl.Fn.Positions.Lookup(f.ip - 1)
+}
+
+// inPrologue reports whether the frame is binding its arguments.
+func (f *Frame) inPrologue() bool {
+	return f.ip-1 < f.cl.Fn.Prologue
+}
@@ -0,0 +1,524 @@
+package vm
+
+import (
+	"fmt"
+	"monkey/code"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/object"
+)
+
+const StackSize = 2048
+
+var infixOperators = map[code.Opcode]string{
+	code.OpAdd:          "+",
+	code.OpSub:          "-",
+	code.OpMul:          "*",
+	code.OpDiv:          "/",
+	code.OpMod:          "%",
+	code.OpEqual:        "==",
+	code.OpNotEqual:     "!=",
+	code.OpGreaterThan:  ">",
+	code.OpLessThan:     "<",
+	code.OpGreaterEqual: ">=",
+	code.OpLessEqual:    "<=",
+}
+
+// handler is a try block waiting for errors raised in frame.
+type handler struct {
+	frame   int
+	catchIP int
+	sp      int
+}
+
+// iterator walks the items of a for loop.
+type iterator struct {
+	items []object.Object
+	next  int
+}
+
+func (it *iterator) Type() object.ObjectType {
+	return "ITERATOR"
+}
+
+func (it *iterator) Inspect() string {
+	return "iterator"
+}
+
+// VM executes bytecode. Operators, builtins and error messages behave as
+// in the evaluator, including the call depth limit and checked arithmetic
+// of the options the VM was created with.
+type VM struct {
+	options evaluator.Options
+	args    *object.Builtin // the `args` builtin, returning options.Args
+
+	constants   []object.Object
+	globals     []object.Object
+	globalNames []string
+
+	stack []object.Object
+	sp    int // Always points to the next free slot. Top of stack is stack[sp-1]
+
+	frames   []*Frame
+	handlers []handler
+
+	// openUpvalues are the captured variables still on the stack, in
+	// ascending slot order.
+	openUpvalues []*object.Upvalue
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	return NewWithOptions(bytecode, evaluator.Options{})
+}
+
+// NewWithOptions creates a VM that runs bytecode with the settings in opts.
+// The context and step budget of opts are not used.
+func NewWithOptions(bytecode *compiler.Bytecode, opts evaluator.Options) *VM {
+	mainClosure := &object.Closure{Fn: bytecode.Main}
+	mainFrame := NewFrame(mainClosure, 0, 0, bytecode.Main.Positions.Lookup(0))
+
+	vm := &VM{
+		options:     opts,
+		args:        object.ArgsBuiltin(opts.Args),
+		constants:   bytecode.Constants,
+		globals:     make([]object.Object, len(bytecode.Globals)),
+		globalNames: bytecode.Globals,
+		stack:       make([]object.Object, StackSize),
+		frames:      []*Frame{mainFrame},
+	}
+	vm.ensureStack(bytecode.Main.NumLocals)
+	vm.sp = bytecode.Main.NumLocals
+	return vm
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[len(vm.frames)-1]
+}
+
+// Run executes the program and returns the value of its last statement
+// or the error that ended it.
+func (vm *VM) Run() object.Object {
+	for {
+		frame := vm.currentFrame()
+		ins := frame.Instructions()
+		ip := frame.ip
+		op := code.Opcode(ins[ip])
+		frame.ip++
+
+		var err *object.Error
+		switch op {
+		case code.OpConstant:
+			constIndex := vm.readUint16(frame)
+			vm.push(vm.constants[constIndex])
+
+		case code.OpPop:
+			vm.pop()
+
+		case code.OpDup:
+			vm.push(vm.stack[vm.sp-1])
+
+		case code.OpSwap:
+			vm.stack[vm.sp-1], vm.stack[vm.sp-2] = vm.stack[vm.sp-2], vm.stack[vm.sp-1]
+
+		case code.OpTrue:
+			vm.push(object.TRUE)
+
+		case code.OpFalse:
+			vm.push(object.FALSE)
+
+		case code.OpNull:
+			vm.push(object.NULL)
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+			code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan,
+			code.OpGreaterEqual, code.OpLessEqual:
+			right := vm.pop()
+			left := vm.pop()
+			err = vm.pushResult(evaluator.Infix(infixOperators[op], left, right, vm.options.CheckedArithmetic))
+
+		case code.OpMinus:
+			err = vm.pushResult(evaluator.Prefix("-", vm.pop(), vm.options.CheckedArithmetic))
+
+		case code.OpBang:
+			err = vm.pushResult(evaluator.Prefix("!", vm.pop(), vm.options.CheckedArithmetic))
+
+		case code.OpBool:
+			vm.push(nativeBoolToBooleanObject(evaluator.IsTruthy(vm.pop())))
+
+		case code.OpJump:
+			frame.ip = int(vm.readUint16(frame))
+
+		case code.OpJumpNotTruthy:
+			target := int(vm.readUint16(frame))
+			if !evaluator.IsTruthy(vm.pop()) {
+				frame.ip = target
+			}
+
+		case code.OpGetGlobal:
+			globalIndex := vm.readUint16(frame)
+			value := vm.globals[globalIndex]
+			if value == nil {
+				err = newError("identifier not found: %s", vm.globalNames[globalIndex])
+				break
+			}
+			vm.push(value)
+
+		case code.OpSetGlobal:
+			globalIndex := vm.readUint16(frame)
+			vm.globals[globalIndex] = vm.pop()
+
+		case code.OpAssignGlobal:
+			globalIndex := vm.readUint16(frame)
+			value := vm.pop()
+			if vm.globals[globalIndex] == nil {
+				err = newError("cannot assign to undefined identifier: %s", vm.globalNames[globalIndex])
+				break
+			}
+			vm.globals[globalIndex] = value
+
+		case code.OpGetLocal:
+			localIndex := int(vm.readUint16(frame))
+			value := vm.stack[frame.basePointer+localIndex]
+			if value == nil {
+				err = newError("identifier not found: %s", frame.cl.Fn.LocalNames[localIndex])
+				break
+			}
+			vm.push(value)
+
+		case code.OpSetLocal:
+			localIndex := int(vm.readUint16(frame))
+			vm.stack[frame.basePointer+localIndex] = vm.pop()
+
+		case code.OpGetFree:
+			freeIndex := vm.readUint8(frame)
+			value := vm.upvalue(frame.cl.Free[freeIndex])
+			if value == nil {
+				err = newError("identifier not found: %s", frame.cl.Fn.FreeNames[freeIndex])
+				break
+			}
+			vm.push(value)
+
+		case code.OpSetFree:
+			freeIndex := vm.readUint8(frame)
+			vm.setUpvalue(frame.cl.Free[freeIndex], vm.pop())
+
+		case code.OpGetBuiltin:
+			builtinIndex := vm.readUint8(frame)
+			if def := object.Builtins[builtinIndex]; def.Name == "args" {
+				vm.push(vm.args)
+			} else {
+				vm.push(def.Builtin)
+			}
+
+		case code.OpArray:
+			numElements := int(vm.readUint16(frame))
+			elements := make([]object.Object, numElements)
+			copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+			vm.sp -= numElements
+			vm.push(&object.Array{Elements: elements})
+
+		case code.OpHash:
+			numElements := int(vm.readUint16(frame))
+			var hash object.Object
+			hash, err = vm.buildHash(vm.sp-numElements, vm.sp)
+			if err != nil {
+				break
+			}
+			vm.sp -= numElements
+			vm.push(hash)
+
+		case code.OpAppend:
+			value := vm.pop()
+			array, ok := vm.stack[vm.sp-1].(*object.Array)
+			if !ok {
+				err = malformed(op, vm.stack[vm.sp-1])
+				break
+			}
+			array.Elements = append(array.Elements, value)
+
+		case code.OpSpreadAppend:
+			value := vm.pop()
+			spread, ok := value.(*object.Array)
+			if !ok {
+				err = newError("cannot spread %s", value.Type())
+				break
+			}
+			array, ok := vm.stack[vm.sp-1].(*object.Array)
+			if !ok {
+				err = malformed(op, vm.stack[vm.sp-1])
+				break
+			}
+			array.Elements = append(array.Elements, spread.Elements...)
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			err = vm.pushResult(evaluator.Index(left, index))
+
+		case code.OpSetIndex:
+			op := code.Opcode(vm.readUint8(frame))
+			value := vm.pop()
+			index := vm.pop()
+			container := vm.pop()
+			if op != 0 {
+				current := evaluator.Index(container, index)
+				if e, ok := current.(*object.Error); ok {
+					err = e
+					break
+				}
+				value = evaluator.Infix(infixOperators[op], current, value, vm.options.CheckedArithmetic)
+				if e, ok := value.(*object.Error); ok {
+					err = e
+					break
+				}
+			}
+			err = vm.pushResult(evaluator.SetIndex(container, index, value))
+
+		case code.OpCall:
+			numArgs := int(vm.readUint8(frame))
+			err = vm.callFunction(numArgs, false)
+
+		case code.OpTailCall:
+			numArgs := int(vm.readUint8(frame))
+			err = vm.callFunction(numArgs, true)
+
+		case code.OpCallSpread:
+			tail := vm.readUint8(frame) == 1
+			args, ok := vm.stack[vm.sp-1].(*object.Array)
+			if !ok {
+				err = malformed(op, vm.stack[vm.sp-1])
+				break
+			}
+			vm.pop()
+			for _, arg := range args.Elements {
+				vm.push(arg)
+			}
+			err = vm.callFunction(len(args.Elements), tail)
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+			if len(vm.frames) == 1 {
+				return returnValue
+			}
+			vm.popFrame()
+			vm.push(returnValue)
+
+		case code.OpClosure:
+			constIndex := vm.readUint16(frame)
+			numFree := int(vm.readUint8(frame))
+			free := make([]*object.Upvalue, numFree)
+			for i := 0; i < numFree && err == nil; i++ {
+				var ok bool
+				if free[i], ok = vm.stack[vm.sp-numFree+i].(*object.Upvalue); !ok {
+					err = malformed(op, vm.stack[vm.sp-numFree+i])
+				}
+			}
+			if err != nil {
+				break
+			}
+			vm.sp -= numFree
+			vm.push(&object.Closure{Fn: vm.constants[constIndex].(*object.CompiledFunction), Free: free})
+
+		case code.OpCaptureLocal:
+			localIndex := int(vm.readUint16(frame))
+			vm.push(vm.captureUpvalue(frame.basePointer + localIndex))
+
+		case code.OpCaptureFree:
+			freeIndex := vm.readUint8(frame)
+			vm.push(frame.cl.Free[freeIndex])
+
+		case code.OpCloseUpvalues:
+			localIndex := int(vm.readUint16(frame))
+			count := int(vm.readUint16(frame))
+			vm.closeUpvalueRange(frame.basePointer+localIndex, count)
+
+		case code.OpJumpIfArg:
+			paramIndex := int(vm.readUint8(frame))
+			target := int(vm.readUint16(frame))
+			if paramIndex < frame.argc {
+				frame.ip = target
+			}
+
+		case code.OpIterInit:
+			var items []object.Object
+			items, err = evaluator.IterationItems(vm.pop())
+			if err == nil {
+				vm.push(&iterator{items: items})
+			}
+
+		case code.OpIterNext:
+			target := int(vm.readUint16(frame))
+			it, ok := vm.stack[vm.sp-1].(*iterator)
+			if !ok {
+				err = malformed(op, vm.stack[vm.sp-1])
+				break
+			}
+			vm.pop()
+			if it.next >= len(it.items) {
+				frame.ip = target
+				break
+			}
+			vm.push(it.items[it.next])
+			it.next++
+
+		case code.OpMatchEqual:
+			value := vm.pop()
+			pattern := vm.pop()
+			vm.push(nativeBoolToBooleanObject(evaluator.Equal(pattern, value)))
+
+		case code.OpMatchLength:
+			length := int(vm.readUint16(frame))
+			array, ok := vm.pop().(*object.Array)
+			vm.push(nativeBoolToBooleanObject(ok && len(array.Elements) == length))
+
+		case code.OpDestructureArray:
+			numElements := int(vm.readUint16(frame))
+			rest := vm.readUint8(frame) == 1
+			pattern := vm.constants[vm.readUint16(frame)].(*object.String)
+			var values []object.Object
+			values, err = evaluator.DestructureArray(vm.pop(), numElements, rest, pattern.Value)
+			vm.pushReversed(values)
+
+		case code.OpDestructureHash:
+			keys := vm.constants[vm.readUint16(frame)].(*object.Array)
+			pattern := vm.constants[vm.readUint16(frame)].(*object.String)
+			names := make([]string, len(keys.Elements))
+			for i, key := range keys.Elements {
+				names[i] = key.(*object.String).Value
+			}
+			var values []object.Object
+			values, err = evaluator.DestructureHash(vm.pop(), names, pattern.Value)
+			vm.pushReversed(values)
+
+		case code.OpTry:
+			catchIP := int(vm.readUint16(frame))
+			vm.handlers = append(vm.handlers, handler{frame: len(vm.frames) - 1, catchIP: catchIP, sp: vm.sp})
+
+		case code.OpEndTry:
+			if n := len(vm.handlers); n == 0 || vm.handlers[n-1].frame != len(vm.frames)-1 {
+				err = newError("malformed program: OpEndTry without OpTry")
+				break
+			}
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+		case code.OpCatch:
+			caught, ok := vm.stack[vm.sp-1].(*object.Error)
+			if !ok {
+				err = malformed(op, vm.stack[vm.sp-1])
+				break
+			}
+			vm.pop()
+			vm.push(evaluator.CaughtError(caught))
+
+		case code.OpThrow:
+			thrown, ok := vm.stack[vm.sp-1].(*object.Error)
+			if !ok {
+				err = malformed(op, vm.stack[vm.sp-1])
+				break
+			}
+			vm.pop()
+			err = thrown
+
+		default:
+			err = newError("unknown opcode %d", op)
+		}
+
+		if err != nil && !vm.raise(err) {
+			return err
+		}
+	}
+}
+
+func (vm *VM) readUint16(frame *Frame) uint16 {
+	value := code.ReadUint16(frame.Instructions()[frame.ip:])
+	frame.ip += 2
+	return value
+}
+
+func (vm *VM) readUint8(frame *Frame) uint8 {
+	value := code.ReadUint8(frame.Instructions()[frame.ip:])
+	frame.ip++
+	return value
+}
+
+func (vm *VM) push(o object.Object) {
+	if vm.sp >= len(vm.stack) {
+		vm.ensureStack(vm.sp + 1)
+	}
+	vm.stack[vm.sp] = o
+	vm.sp++
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+// pushResult pushes the result of an operation unless it is an error,
+// which it returns instead.
+func (vm *VM) pushResult(result object.Object) *object.Error {
+	if err, ok := result.(*object.Error); ok {
+		return err
+	}
+	vm.push(result)
+	return nil
+}
+
+func (vm *VM) pushReversed(values []object.Object) {
+	for i := len(values) - 1; i >= 0; i-- {
+		vm.push(values[i])
+	}
+}
+
+// ensureStack grows the stack to hold at least size slots. Open upvalues
+// refer to slots by index, so they stay valid.
+func (vm *VM) ensureStack(size int) {
+	if size <= len(vm.stack) {
+		return
+	}
+	newSize := 2 * len(vm.stack)
+	for newSize < size {
+		newSize *= 2
+	}
+	stack := make([]object.Object, newSize)
+	copy(stack, vm.stack)
+	vm.stack = stack
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, *object.Error) {
+	hash := object.NewHash()
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		hashKey, err := evaluator.HashKey(key)
+		if err != nil {
+			return nil, err
+		}
+		hash.Set(hashKey, object.HashPair{Key: key, Value: value})
+	}
+	return hash, nil
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return object.TRUE
+	}
+	return object.FALSE
+}
+
+func newError(format string, a ...any) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
+
+// malformed reports an instruction applied to a value the compiler never
+// gives it, which only happens with a damaged or crafted compiled program.
+func malformed(op code.Opcode, value object.Object) *object.Error {
+	def, _ := code.Lookup(byte(op))
+	if value == nil {
+		return newError("malformed program: %s cannot use an empty slot", def.Name)
+	}
+	return newError("malformed program: %s cannot use %s", def.Name, value.Type())
+}
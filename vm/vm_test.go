@@ -0,0 +1,520 @@
+package vm
+
+import (
+	"bytes"
+	"fmt"
+	"monkey/ast"
+	"monkey/code"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"strings"
+	"testing"
+)
+
+type vmTestCase struct {
+	input    string
+	expected interface{}
+}
+
+// vmError is the expected message of a runtime error.
+type vmError string
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1", 1},
+		{"1 + 2", 3},
+		{"1 - 2", -1},
+		{"4 / 2", 2},
+		{"50 / 2 * 2 + 10 - 5", 55},
+		{"5 * (2 + 10)", 60},
+		{"-5", -5},
+		{"-50 + 100 + -50", 0},
+		{"7 % 3", 1},
+		{"1.5 + 2", 3.5},
+		{"1 / 0", vmError("division by zero")},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"true", true},
+		{"1 < 2", true},
+		{"1 >= 2", false},
+		{"2 <= 2", true},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"(1 < 2) == true", true},
+		{"!5", false},
+		{"!!true", true},
+		{"!(if (false) { 5; })", true},
+		{"true && 5", true},
+		{"0 && false", false},
+		{"false || 0", true},
+		{"null_value || false", vmError("identifier not found: null_value")},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []vmTestCase{
+		{"if (true) { 10 }", 10},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (false) { 10 }", Null},
+		{"if (1 > 2) { 10 } else if (2 > 1) { 30 } else { 20 }", 30},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let one = 1; one", 1},
+		{"let one = 1; let two = one + one; one + two", 3},
+		{"let x = 1; x = x + 1; x += 3; x", 5},
+		{"let x = 1; let x = x + 1; x", 2},
+		{"y = 1", vmError("cannot assign to undefined identifier: y")},
+		{"len = 1", vmError("cannot assign to undefined identifier: len")},
+		{"y += 1", vmError("identifier not found: y")},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStringsArraysAndHashes(t *testing.T) {
+	tests := []vmTestCase{
+		{`"mon" + "key"`, "monkey"},
+		{"[1, 2 * 2, 3 + 3]", []int{1, 4, 6}},
+		{"[1, ...[2, 3], 4]", []int{1, 2, 3, 4}},
+		{"[1, ...2]", vmError("cannot spread INTEGER")},
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][3]", Null},
+		{`{"a": 1, "b": 2}["b"]`, 2},
+		{`{1: 1}[2]`, Null},
+		{`{[1]: 2}`, vmError("unusable as hash key: ARRAY")},
+		{"let a = [1, 2, 3]; a[1] = 9; a[0] += 1; a", []int{2, 9, 3}},
+		{`let h = {}; h["x"] = 1; h["x"] *= 5; h["x"]`, 5},
+		{"[1][true]", vmError("index operator not supported: BOOLEAN")},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let f = fn() { 5 + 10 }; f()", 15},
+		{"let f = fn() { }; f()", Null},
+		{"let f = fn() { return 99; 100 }; f()", 99},
+		{"let f = fn(a, b) { let c = a + b; c }; f(1, 2)", 3},
+		{"let f = fn(a, b = a + 1) { [a, b] }; f(1)", []int{1, 2}},
+		{"let f = fn(a, b = a + 1) { [a, b] }; f(1, 5)", []int{1, 5}},
+		{"let f = fn(a, ...rest) { rest }; f(1, 2, 3)", []int{2, 3}},
+		{"let f = fn(a, ...rest) { rest }; f(1)", []int{}},
+		{"let f = fn(...xs) { len(xs) }; f(...[1, 2, 3], 4)", 4},
+		{"let f = fn([a, b], {c}) { a + b + c }; f([1, 2], {\"c\": 3})", 6},
+		{"fn(a) { a }()", vmError("wrong number of arguments to anonymous function. got=0, want=1")},
+		{"let f = fn(a, b = 1) { a }; f(1, 2, 3)", vmError("wrong number of arguments to `f`. got=3, want=1..2")},
+		{"5()", vmError("not a function: INTEGER")},
+		{"len([1, 2])", 2},
+		{`len(1)`, vmError("argument to `len` not supported, got INTEGER")},
+		{"rest(push([1], 2))", []int{2}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{"let adder = fn(a) { fn(b) { a + b } }; adder(1)(2)", 3},
+		{"let a = fn(x) { fn(y) { fn(z) { x + y + z } } }; a(1)(2)(3)", 6},
+		{"let make = fn() { let c = 0; fn() { c += 1; c } }; let k = make(); k(); k(); k()", 3},
+		{"let counter = fn() { let n = 0; [fn() { n += 1 }, fn() { n }] }; let [inc, get] = counter(); inc(); inc(); get()", 2},
+		{"let f = fn() { let x = 1; let g = fn() { x }; x = 5; g() }; f()", 5},
+		{"let fs = []; for (i in [1, 2, 3]) { fs = push(fs, fn() { i }) } [fs[0](), fs[1](), fs[2]()]", []int{1, 2, 3}},
+		{"let outer = fn() { let fact = fn(n) { if (n == 0) { 1 } else { n * fact(n - 1) } }; fact(5) }; outer()", 120},
+		{"let x = 10; let f = fn() { let x = x + 1; x }; [f(), x]", []int{11, 10}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15)", 610},
+		{"let loop = fn(n, acc) { if (n == 0) { acc } else { loop(n - 1, acc + n) } }; loop(100000, 0)", 5000050000},
+		{"let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } }; let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } }; even(100001)", false},
+		{"let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(5000)", 5000},
+		{"let f = fn(n) { 1 + f(n + 1) }; f(0)", vmError("maximum call depth of 10000 exceeded")},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{"let i = 0; while (i < 5) { i += 1 } i", 5},
+		{"let s = 0; let i = 0; while (i < 10) { i += 1; if (i % 2 == 0) { continue } if (i > 7) { break } s += i } s", 16},
+		{"let s = 0; for (x in [1, 2, 3]) { s += x } s", 6},
+		{`let s = ""; for (c in "abc") { s = c + s } s`, "cba"},
+		{"for (x in [1]) { x }", Null},
+		{"for (x in 5) { x }", vmError("cannot iterate over INTEGER")},
+		{"let f = fn() { for (x in [1, 2, 3]) { if (x == 2) { return x } } }; f()", 2},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`match (2) { 1 => "one", 2, 3 => "few", _ => "many" }`, "few"},
+		{`match (9) { 1 => "one" }`, Null},
+		{`match ([1, 2]) { [1, _] => "yes", _ => "no" }`, "yes"},
+		{`match ([1, [2, 3]]) { [1, [2, 4]] => "a", [1, [_, 3]] => "b" }`, "b"},
+		{`match (-1) { -1 => "minus one" }`, "minus one"},
+		{`match (1.0) { 1 => "number" }`, "number"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []vmTestCase{
+		{"let [a, b, ...c] = [1, 2, 3, 4]; [a, b, c[0], c[1]]", []int{1, 2, 3, 4}},
+		{`let {x, y} = {"x": 1, "y": 2}; x + y`, 3},
+		{"let [a, [b, c]] = [1, [2, 3]]; a + b + c", 6},
+		{"let [a, b] = [1]", vmError("cannot destructure array of length 1 with pattern [a, b]")},
+		{`let {x} = {}`, vmError(`hash has no key "x" for pattern {x}`)},
+		{"let [a] = 1", vmError("cannot destructure INTEGER with pattern [a]")},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []vmTestCase{
+		{`try { throw("boom") } catch (e) { e["message"] }`, "boom"},
+		{`try { 1 / 0 } catch (e) { [e["line"], e["column"]] }`, []int{1, 7}},
+		{`try { 1 } catch (e) { 2 }`, 1},
+		{`try { throw(5) } catch (e) { e["value"] } finally { 9 }`, 5},
+		{`let f = fn() { try { 1 } finally { return 2 } }; f()`, 2},
+		{`let f = fn() { try { return 1 } finally { 3 } }; f()`, 1},
+		{`try { try { throw(1) } finally { 2 } } catch (e) { e["value"] + 10 }`, 11},
+		{`let f = fn() { throw("deep") }; let g = fn() { f() + 1 }; try { g() } catch (e) { e["message"] }`, "deep"},
+		{`let s = 0; for (x in [1, 2, 3]) { try { if (x == 2) { continue } s += x } finally { s += 10 } } s`, 34},
+		{`let s = 0; while (true) { try { break } finally { s = 7 } } s`, 7},
+		{`try { throw("a") } catch (e) { throw("b") }`, vmError("b")},
+		{`try { throw("a") } finally { 1 }`, vmError("a")},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestErrorPositionsAndStack(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		stack    []string
+	}{
+		{"1 + true", "Error at 1:1: type mismatch: INTEGER + BOOLEAN", nil},
+		{"let add = fn(a, b) { a + b };\nadd(1, true)", "Error at 1:22: type mismatch: INTEGER + BOOLEAN", []string{"in `add` called at 2:1"}},
+		{
+			"let inner = fn() { missing };\nlet outer = fn() {\n  inner() + 1\n};\nouter()",
+			"Error at 1:20: identifier not found: missing",
+			[]string{"in `inner` called at 3:3", "in `outer` called at 5:1"},
+		},
+		{"let inner = fn() { missing };\nlet outer = fn() { inner() };\nouter()", "Error at 1:20: identifier not found: missing", []string{"in `inner` called at 2:20"}},
+		{"let f = fn(a) { a };\nf(1, 2)", "Error at 2:1: wrong number of arguments to `f`. got=2, want=1", nil},
+		{"let f = fn([a]) { a };\nf(1)", "Error at 2:1: cannot destructure INTEGER with pattern [a]", nil},
+		{"let f = fn(a = missing) { a };\nf()", "Error at 1:16: identifier not found: missing", nil},
+		{"let f = fn() { len(1) };\nlet g = fn() { f() + 1 };\ng()", "Error at 1:16: argument to `len` not supported, got INTEGER", []string{"in `g` called at 3:1"}},
+	}
+
+	for _, tt := range tests {
+		result := runVm(t, tt.input)
+		err, ok := result.(*object.Error)
+		if !ok {
+			t.Errorf("%s: no error returned. got=%s", tt.input, result.Inspect())
+			continue
+		}
+		if err.Inspect() != tt.expected {
+			t.Errorf("%s: wrong error. want=%q, got=%q", tt.input, tt.expected, err.Inspect())
+		}
+		if len(err.Stack) != len(tt.stack) {
+			t.Errorf("%s: wrong stack depth. want=%d, got=%d", tt.input, len(tt.stack), len(err.Stack))
+			continue
+		}
+		for i, frame := range err.Stack {
+			if frame.String() != tt.stack[i] {
+				t.Errorf("%s: wrong frame %d. want=%q, got=%q", tt.input, i, tt.stack[i], frame.String())
+			}
+		}
+	}
+}
+
+func TestArgsBuiltin(t *testing.T) {
+	opts := evaluator.Options{Args: []string{"one", "two"}}
+	if got := runVmWithOptions(t, "args()", opts).Inspect(); got != "[one, two]" {
+		t.Errorf("wrong args. want=[one, two], got=%s", got)
+	}
+	if got := runVmWithOptions(t, "args()", evaluator.Options{}).Inspect(); got != "[]" {
+		t.Errorf("wrong args. want=[], got=%s", got)
+	}
+}
+
+func TestMaxCallDepth(t *testing.T) {
+	opts := evaluator.Options{MaxCallDepth: 50}
+	result := runVmWithOptions(t, "let f = fn(n) { 1 + f(n + 1) }; f(0)", opts)
+	err, ok := result.(*object.Error)
+	if !ok {
+		t.Fatalf("no error returned. got=%s", result.Inspect())
+	}
+	if err.Message != "maximum call depth of 50 exceeded" {
+		t.Errorf("wrong error message. got=%q", err.Message)
+	}
+	want := "in `f` called at 1:21\n... 48 more\nin `f` called at 1:33"
+	if got := strings.Join(err.Traceback(), "\n"); got != want {
+		t.Errorf("wrong traceback.\nwant=%q\ngot= %q", want, got)
+	}
+}
+
+func TestCheckedArithmetic(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 + 1", "integer overflow: 9223372036854775807 + 1"},
+		{"let x = 9223372036854775807; x += 1", "integer overflow: 9223372036854775807 + 1"},
+		{"-(-9223372036854775807 - 1)", "integer overflow: -(-9223372036854775808)"},
+	}
+
+	opts := evaluator.Options{CheckedArithmetic: true}
+	for _, tt := range tests {
+		result := runVmWithOptions(t, tt.input, opts)
+		err, ok := result.(*object.Error)
+		if !ok {
+			t.Errorf("%s: no error returned. got=%s", tt.input, result.Inspect())
+			continue
+		}
+		if err.Message != tt.expected {
+			t.Errorf("%s: wrong error message. want=%q, got=%q", tt.input, tt.expected, err.Message)
+		}
+	}
+
+	if err := testExpectedObject(-9223372036854775808, runVm(t, "9223372036854775807 + 1")); err != nil {
+		t.Errorf("unchecked arithmetic: %s", err)
+	}
+}
+
+// TestRunMalformedBytecode runs compiled programs whose instructions pass
+// validation but use values the compiler never gives them.
+func TestRunMalformedBytecode(t *testing.T) {
+	tests := []struct {
+		instructions []code.Instructions
+		expected     string
+	}{
+		{
+			[]code.Instructions{
+				code.Make(code.OpTrue), code.Make(code.OpIterNext, 5), code.Make(code.OpReturnValue),
+				code.Make(code.OpNull), code.Make(code.OpReturnValue),
+			},
+			"malformed program: OpIterNext cannot use BOOLEAN",
+		},
+		{
+			[]code.Instructions{code.Make(code.OpEndTry), code.Make(code.OpNull), code.Make(code.OpReturnValue)},
+			"malformed program: OpEndTry without OpTry",
+		},
+		{
+			[]code.Instructions{code.Make(code.OpTrue), code.Make(code.OpThrow)},
+			"malformed program: OpThrow cannot use BOOLEAN",
+		},
+		{
+			[]code.Instructions{code.Make(code.OpTrue), code.Make(code.OpCatch), code.Make(code.OpReturnValue)},
+			"malformed program: OpCatch cannot use BOOLEAN",
+		},
+		{
+			[]code.Instructions{
+				code.Make(code.OpGetBuiltin, 0), code.Make(code.OpTrue), code.Make(code.OpCallSpread, 0),
+				code.Make(code.OpReturnValue),
+			},
+			"malformed program: OpCallSpread cannot use BOOLEAN",
+		},
+		{
+			[]code.Instructions{
+				code.Make(code.OpTrue), code.Make(code.OpTrue), code.Make(code.OpAppend), code.Make(code.OpReturnValue),
+			},
+			"malformed program: OpAppend cannot use BOOLEAN",
+		},
+		{
+			[]code.Instructions{
+				code.Make(code.OpTrue), code.Make(code.OpArray, 0), code.Make(code.OpSpreadAppend),
+				code.Make(code.OpReturnValue),
+			},
+			"malformed program: OpSpreadAppend cannot use BOOLEAN",
+		},
+		{
+			[]code.Instructions{
+				code.Make(code.OpTrue), code.Make(code.OpClosure, 1, 1), code.Make(code.OpReturnValue),
+			},
+			"malformed program: OpClosure cannot use BOOLEAN",
+		},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse("fn() { 1 }")); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		bytecode := comp.Bytecode()
+		bytecode.Main.Instructions = nil
+		for _, ins := range tt.instructions {
+			bytecode.Main.Instructions = append(bytecode.Main.Instructions, ins...)
+		}
+
+		var buf bytes.Buffer
+		if err := compiler.WriteBytecode(&buf, bytecode, false); err != nil {
+			t.Fatalf("WriteBytecode: %s", err)
+		}
+		read, err := compiler.ReadBytecode(&buf)
+		if err != nil {
+			t.Errorf("%s: ReadBytecode: %s", tt.expected, err)
+			continue
+		}
+
+		result := New(read).Run()
+		if err, ok := result.(*object.Error); !ok || err.Message != tt.expected {
+			t.Errorf("wrong result. want=%q, got=%s", tt.expected, result.Inspect())
+		}
+	}
+}
+
+func TestRunBytecodeFromFile(t *testing.T) {
+	tests := []struct {
+		input     string
+		lineTable bool
+		expected  string
+	}{
+		{"let f = fn(x, y = 2) { [x, y] };\nf(1)", true, "[1, 2]"},
+		{"let c = fn() { let n = 0; fn() { n = n + 1 } }();\nc(); c()", true, "2"},
+		{"let f = fn() { 1 / 0 };\nf()", true, "Error at 1:16: division by zero"},
+		{"let f = fn() { 1 / 0 };\nf()", false, "Error: division by zero"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		var buf bytes.Buffer
+		if err := compiler.WriteBytecode(&buf, comp.Bytecode(), tt.lineTable); err != nil {
+			t.Fatalf("WriteBytecode: %s", err)
+		}
+		bytecode, err := compiler.ReadBytecode(&buf)
+		if err != nil {
+			t.Fatalf("ReadBytecode: %s", err)
+		}
+
+		result := New(bytecode).Run()
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: wrong result. want=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
+
+// Null stands for the expected null value.
+var Null = object.NULL
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func runVm(t *testing.T, input string) object.Object {
+	t.Helper()
+
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return New(comp.Bytecode()).Run()
+}
+
+func runVmWithOptions(t *testing.T, input string, opts evaluator.Options) object.Object {
+	t.Helper()
+
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return NewWithOptions(comp.Bytecode(), opts).Run()
+}
+
+func runVmTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		result := runVm(t, tt.input)
+		if err := testExpectedObject(tt.expected, result); err != nil {
+			t.Errorf("%s: %s", tt.input, err)
+		}
+	}
+}
+
+func testExpectedObject(expected interface{}, actual object.Object) error {
+	switch expected := expected.(type) {
+	case int:
+		return testIntegerObject(int64(expected), actual)
+	case float64:
+		result, ok := actual.(*object.Float)
+		if !ok || result.Value != expected {
+			return fmt.Errorf("want float %g, got=%s", expected, actual.Inspect())
+		}
+	case bool:
+		result, ok := actual.(*object.Boolean)
+		if !ok || result.Value != expected {
+			return fmt.Errorf("want %t, got=%s", expected, actual.Inspect())
+		}
+	case string:
+		result, ok := actual.(*object.String)
+		if !ok || result.Value != expected {
+			return fmt.Errorf("want string %q, got=%s", expected, actual.Inspect())
+		}
+	case []int:
+		array, ok := actual.(*object.Array)
+		if !ok || len(array.Elements) != len(expected) {
+			return fmt.Errorf("want array %v, got=%s", expected, actual.Inspect())
+		}
+		for i, element := range expected {
+			if err := testIntegerObject(int64(element), array.Elements[i]); err != nil {
+				return err
+			}
+		}
+	case *object.Null:
+		if actual != Null {
+			return fmt.Errorf("want null, got=%s", actual.Inspect())
+		}
+	case vmError:
+		err, ok := actual.(*object.Error)
+		if !ok || err.Message != string(expected) {
+			return fmt.Errorf("want error %q, got=%s", expected, actual.Inspect())
+		}
+	}
+	return nil
+}
+
+func testIntegerObject(expected int64, actual object.Object) error {
+	result, ok := actual.(*object.Integer)
+	if !ok {
+		return fmt.Errorf("object is not Integer. got=%T (%+v)", actual, actual)
+	}
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
+	}
+	return nil
+}